@@ -0,0 +1,79 @@
+package cbr
+
+import (
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RubleCode is the currency the Central Bank of Russia quotes every rate in
+const RubleCode = "RUB"
+
+// Rate is the exact price of one unit of the currency in rubles
+type Rate struct {
+	Code  string
+	Value *big.Rat
+}
+
+// Daily is the parsed XML_daily.asp document
+type Daily struct {
+	Date  time.Time
+	Rates []Rate
+}
+
+type valCurs struct {
+	Date    string   `xml:"Date,attr"`
+	Valutes []valute `xml:"Valute"`
+}
+
+type valute struct {
+	CharCode string `xml:"CharCode"`
+	Nominal  string `xml:"Nominal"`
+	Value    string `xml:"Value"`
+}
+
+// ParseDaily parses the daily rates document, which comes in windows-1251
+func ParseDaily(r io.Reader) (Daily, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "windows-1251") {
+			return charmap.Windows1251.NewDecoder().Reader(input), nil
+		}
+
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+
+	var doc valCurs
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return Daily{}, err
+	}
+
+	date, err := time.Parse("02.01.2006", doc.Date)
+	if err != nil {
+		return Daily{}, fmt.Errorf("invalid date %q: %w", doc.Date, err)
+	}
+
+	daily := Daily{Date: date, Rates: make([]Rate, 0, len(doc.Valutes))}
+	for _, v := range doc.Valutes {
+		nominal, err := strconv.ParseInt(strings.TrimSpace(v.Nominal), 10, 64)
+		if err != nil || nominal <= 0 {
+			return Daily{}, fmt.Errorf("invalid nominal of %s: %q", v.CharCode, v.Nominal)
+		}
+
+		value, ok := new(big.Rat).SetString(strings.ReplaceAll(strings.TrimSpace(v.Value), ",", "."))
+		if !ok || value.Sign() <= 0 {
+			return Daily{}, fmt.Errorf("invalid value of %s: %q", v.CharCode, v.Value)
+		}
+
+		value.Quo(value, new(big.Rat).SetInt64(nominal))
+		daily.Rates = append(daily.Rates, Rate{Code: strings.ToUpper(strings.TrimSpace(v.CharCode)), Value: value})
+	}
+
+	return daily, nil
+}
@@ -0,0 +1,87 @@
+package cbr
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding/charmap"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const dailyXml = `<?xml version="1.0" encoding="windows-1251"?>
+<ValCurs Date="19.10.2026" name="Foreign Currency Market">
+	<Valute ID="R01235">
+		<NumCode>840</NumCode>
+		<CharCode>USD</CharCode>
+		<Nominal>1</Nominal>
+		<Name>Доллар США</Name>
+		<Value>80,1234</Value>
+	</Valute>
+	<Valute ID="R01335">
+		<NumCode>398</NumCode>
+		<CharCode>kzt</CharCode>
+		<Nominal>100</Nominal>
+		<Name>Тенге</Name>
+		<Value>16,5432</Value>
+	</Valute>
+</ValCurs>`
+
+func encodeWindows1251(t *testing.T, s string) []byte {
+	data, err := charmap.Windows1251.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestParseDaily(t *testing.T) {
+	daily, err := ParseDaily(bytes.NewReader(encodeWindows1251(t, dailyXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !daily.Date.Equal(time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date %v", daily.Date)
+	}
+
+	want := []struct {
+		code  string
+		value string
+	}{
+		{code: "USD", value: "80.1234"},
+		{code: "KZT", value: "0.165432"},
+	}
+
+	if len(daily.Rates) != len(want) {
+		t.Fatalf("got %d rates, want %d", len(daily.Rates), len(want))
+	}
+
+	for i, w := range want {
+		r := daily.Rates[i]
+		value, _ := new(big.Rat).SetString(w.value)
+		if r.Code != w.code || r.Value.Cmp(value) != 0 {
+			t.Errorf("rate %d: got %s %s, want %s %s", i, r.Code, r.Value.FloatString(6), w.code, w.value)
+		}
+	}
+}
+
+func TestParseDailyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+	}{
+		{name: "bad date", xml: `<ValCurs Date="2026-10-19"></ValCurs>`},
+		{name: "bad nominal", xml: `<ValCurs Date="19.10.2026"><Valute><CharCode>USD</CharCode><Nominal>0</Nominal><Value>80,1</Value></Valute></ValCurs>`},
+		{name: "bad value", xml: `<ValCurs Date="19.10.2026"><Valute><CharCode>USD</CharCode><Nominal>1</Nominal><Value>n/a</Value></Valute></ValCurs>`},
+		{name: "unsupported charset", xml: `<?xml version="1.0" encoding="koi8-r"?><ValCurs Date="19.10.2026"></ValCurs>`},
+		{name: "not xml", xml: `rates`},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseDaily(bytes.NewReader([]byte(tt.xml)))
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/repo"
+	"paint-backend/internal/util/cast"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hexColorRegexp = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// getAllCollections returns the published collections or, for the admin route, all of them
+func (h *HttpHandler) getAllCollections(ctx *fasthttp.RequestCtx, publishedOnly bool) {
+	collections, err := h.collectionsTable.GetAll(publishedOnly)
+	if err != nil {
+		logrus.Error("failed to get all collections: ", err.Error())
+		writeError(ctx, "failed to get collections", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if collections == nil {
+		collections = []repo.Collection{}
+	}
+
+	writeObject(ctx, collections, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) getCollection(ctx *fasthttp.RequestCtx, publishedOnly bool) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	collection, err := h.collectionsTable.GetById(uint(id), publishedOnly)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "collection not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to get collection: ", err.Error())
+		writeError(ctx, "failed to get collection", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, collection, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) insertCollection(ctx *fasthttp.RequestCtx) {
+	editFlagBytes := ctx.QueryArgs().Peek("edit")
+	if len(editFlagBytes) == 0 {
+		writeError(ctx, "empty edit flag", fasthttp.StatusBadRequest)
+		return
+	}
+
+	editFlag, err := strconv.ParseBool(cast.ByteArrayToString(editFlagBytes))
+	if err != nil {
+		writeError(ctx, "failed to parse edit flag: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	var collection repo.Collection
+	err = json.Unmarshal(ctx.PostBody(), &collection)
+	if err != nil {
+		writeError(ctx, "failed to parse collection", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if len(collection.Name) == 0 {
+		writeError(ctx, "empty name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if collection.PublishFrom != nil && collection.PublishTo != nil && !collection.PublishTo.After(*collection.PublishFrom) {
+		writeError(ctx, "publish end must be after publish start", fasthttp.StatusBadRequest)
+		return
+	}
+
+	for i := range collection.Colors {
+		color := &collection.Colors[i]
+		color.Hex = strings.ToLower(color.Hex)
+
+		if !hexColorRegexp.MatchString(color.Hex) {
+			writeError(ctx, fmt.Sprintf("Invalid color %s. Expected #rrggbb", color.Hex), fasthttp.StatusBadRequest)
+			return
+		}
+
+		if color.ProductId == 0 {
+			writeError(ctx, fmt.Sprintf("Color %s has no product", color.Hex), fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(collection.CoverImage) != 0 {
+		var exists bool
+		exists, err = h.storage.ImageExists(collection.CoverImage)
+		if err != nil {
+			logrus.Error("failed to check cover image: ", err.Error())
+			writeError(ctx, "failed to check cover image", fasthttp.StatusInternalServerError)
+			return
+		}
+
+		if !exists {
+			writeError(ctx, "cover image not found", fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	err = h.collectionsTable.Insert(collection, editFlag)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "collection not found", fasthttp.StatusNotFound)
+		return
+	}
+	if errors.Is(err, repo.ErrUnknownCollectionProduct) {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to insert collection: ", err.Error())
+		writeError(ctx, "failed to insert collection", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) deleteCollection(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = h.collectionsTable.Delete(uint(id))
+	if err != nil {
+		logrus.Error("failed to delete collection: ", err.Error())
+		writeError(ctx, "failed to delete collection", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
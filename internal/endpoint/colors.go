@@ -0,0 +1,166 @@
+package endpoint
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"image"
+	"math"
+	"net/http"
+	"paint-backend/internal/imaging"
+	"paint-backend/internal/repo"
+	"sort"
+)
+
+const (
+	paletteSize = 5
+
+	defaultColorSearchLimit = 20
+	maxColorSearchLimit     = 100
+)
+
+// savePalette computes the dominant colors of the image and remembers them
+func (h *HttpHandler) savePalette(name string, img image.Image) ([]string, error) {
+	colors := imaging.DominantColors(img, paletteSize)
+	palette := make([]string, 0, len(colors))
+	for _, c := range colors {
+		palette = append(palette, c.Hex())
+	}
+
+	err := h.imagePalettesTable.Upsert(name, palette)
+	if err != nil {
+		return nil, err
+	}
+
+	return palette, nil
+}
+
+// fillProductPalettes computes the palettes of the attached images uploaded before
+// palettes were computed on upload and pre-fills the product colors from the first
+// image with a palette when they are empty. Failures are only logged, so they never
+// block saving the product.
+func (h *HttpHandler) fillProductPalettes(product *repo.Product) {
+	if len(product.Images) == 0 {
+		return
+	}
+
+	palettes, err := h.imagePalettesTable.GetByNames(product.Images)
+	if err != nil {
+		logrus.Error("failed to get product palettes: ", err.Error())
+		return
+	}
+
+	for _, name := range product.Images {
+		if _, ok := palettes[name]; ok {
+			continue
+		}
+
+		palette, err := h.computePalette(name)
+		if err != nil {
+			logrus.Errorf("failed to compute palette of image %s, skipping it: %s", name, err.Error())
+			continue
+		}
+
+		palettes[name] = palette
+	}
+
+	if len(product.Colors) != 0 {
+		return
+	}
+
+	for _, name := range product.Images {
+		if palette, ok := palettes[name]; ok {
+			product.Colors = palette
+			return
+		}
+	}
+}
+
+func (h *HttpHandler) computePalette(name string) ([]string, error) {
+	data, err := h.storage.GetImage(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return h.savePalette(name, img)
+}
+
+type colorSearchResult struct {
+	repo.Product
+	Distance float64 `json:"distance"`
+}
+
+func (h *HttpHandler) searchProductsByColor(ctx *fasthttp.RequestCtx) {
+	limit := ctx.QueryArgs().GetUintOrZero("limit")
+	if limit == 0 {
+		limit = defaultColorSearchLimit
+	}
+	if limit > maxColorSearchLimit {
+		limit = maxColorSearchLimit
+	}
+
+	body := ctx.PostBody()
+
+	if len(body) > maxImageSizeInBytes {
+		writeError(ctx, "Too big image", fasthttp.StatusBadRequest)
+		return
+	}
+
+	mimeType := http.DetectContentType(body)
+	if mimeType != "image/png" && mimeType != "image/jpeg" {
+		writeError(ctx, fmt.Sprintf("Invalid image type: %s. Allowed only jpeg and png", mimeType), fasthttp.StatusBadRequest)
+		return
+	}
+
+	img, _, err := imaging.Decode(body)
+	if err != nil {
+		writeError(ctx, "failed to decode image: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	colors := imaging.DominantColors(img, paletteSize)
+	if len(colors) == 0 {
+		writeError(ctx, "image has no opaque pixels", fasthttp.StatusBadRequest)
+		return
+	}
+	swatch := colors[0].Lab()
+
+	products, err := h.productsTable.GetColored()
+	if err != nil {
+		logrus.Error("failed to get colored products: ", err.Error())
+		writeError(ctx, "failed to search products", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	results := make([]colorSearchResult, 0, len(products))
+	for _, product := range products {
+		distance := math.MaxFloat64
+		for _, hex := range product.Colors {
+			c, err := imaging.ParseHex(hex)
+			if err != nil {
+				continue
+			}
+
+			distance = math.Min(distance, swatch.Distance(c.Lab()))
+		}
+
+		if distance != math.MaxFloat64 {
+			results = append(results, colorSearchResult{Product: product, Distance: math.Round(distance*100) / 100})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	writeObject(ctx, results, fasthttp.StatusOK)
+}
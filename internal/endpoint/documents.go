@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"paint-backend/internal/repo"
+	"paint-backend/internal/util/cast"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var languageRegexp = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+func (h *HttpHandler) getProductDocuments(ctx *fasthttp.RequestCtx) {
+	productId, err := ctx.QueryArgs().GetUint("product_id")
+	if err != nil {
+		writeError(ctx, "failed to parse product id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	documents, err := h.productDocumentsTable.GetByProductId(uint(productId))
+	if err != nil {
+		logrus.Error("failed to get product documents: ", err.Error())
+		writeError(ctx, "failed to get product documents", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if documents == nil {
+		documents = []repo.ProductDocument{}
+	}
+
+	writeObject(ctx, documents, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) insertProductDocument(ctx *fasthttp.RequestCtx) {
+	productId, err := ctx.QueryArgs().GetUint("product_id")
+	if err != nil {
+		writeError(ctx, "failed to parse product id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	documentType := repo.DocumentType(cast.ByteArrayToString(ctx.QueryArgs().Peek("type")))
+	if !documentType.Valid() {
+		writeError(ctx, fmt.Sprintf("Invalid document type: %s. Allowed only tds and sds", documentType), fasthttp.StatusBadRequest)
+		return
+	}
+
+	language := strings.ToLower(cast.ByteArrayToString(ctx.QueryArgs().Peek("language")))
+	if !languageRegexp.MatchString(language) {
+		writeError(ctx, "invalid language, expected ISO 639 code", fasthttp.StatusBadRequest)
+		return
+	}
+
+	name := path.Base(cast.ByteArrayToString(ctx.QueryArgs().Peek("name")))
+	if name == "." || name == "/" {
+		writeError(ctx, "empty name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+		name += ".pdf"
+	}
+
+	body := ctx.PostBody()
+
+	if len(body) > maxDocumentSizeInBytes {
+		writeError(ctx, "Too big document", fasthttp.StatusBadRequest)
+		return
+	}
+
+	mimeType := http.DetectContentType(body)
+	if mimeType != "application/pdf" {
+		writeError(ctx, fmt.Sprintf("Invalid document type: %s. Allowed only pdf", mimeType), fasthttp.StatusBadRequest)
+		return
+	}
+
+	_, err = h.productsTable.GetById(uint(productId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "product not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to get product: ", err.Error())
+		writeError(ctx, "failed to get product", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	file, err := h.storage.InsertDocument(uint(productId), fmt.Sprintf("%s_%s_%s", documentType, language, name), body)
+	if err != nil {
+		logrus.Error("failed to insert document file: ", err.Error())
+		writeError(ctx, "failed to insert document", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	document := repo.ProductDocument{
+		Name:      name,
+		File:      file,
+		Type:      documentType,
+		Language:  language,
+		ProductId: uint(productId),
+	}
+
+	document.Id, err = h.productDocumentsTable.Insert(document)
+	if err != nil {
+		logrus.Error("failed to insert document: ", err.Error())
+		writeError(ctx, "failed to insert document", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, document, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) deleteProductDocument(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	document, err := h.productDocumentsTable.GetById(uint(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "document not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to get document: ", err.Error())
+		writeError(ctx, "failed to delete document", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	err = h.productDocumentsTable.Delete(document.Id)
+	if err != nil {
+		logrus.Error("failed to delete document: ", err.Error())
+		writeError(ctx, "failed to delete document", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	err = h.storage.DeleteDocument(document.File)
+	if err != nil {
+		logrus.Errorf("failed to delete document file %s: %s", document.File, err.Error())
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
@@ -0,0 +1,132 @@
+package endpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/imaging"
+	"paint-backend/internal/repo"
+)
+
+const imageDuplicateHeader = "X-Image-Duplicate-Of"
+
+type imageDuplicatesReport struct {
+	Backfilled int                   `json:"backfilled,omitempty"`
+	Groups     []repo.DuplicateGroup `json:"groups"`
+}
+
+func imageHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// findDuplicate returns another stored image with the same content, forgetting
+// the hashes of the images that are not in the bucket anymore
+func (h *HttpHandler) findDuplicate(name string, hash string) (string, error) {
+	names, err := h.imageHashesTable.GetNamesByHash(hash)
+	if err != nil {
+		return "", err
+	}
+
+	for _, existing := range names {
+		if existing == name {
+			continue
+		}
+
+		exists, err := h.storage.ImageExists(existing)
+		if err != nil {
+			return "", err
+		}
+
+		if exists {
+			return existing, nil
+		}
+
+		err = h.imageHashesTable.Delete(existing)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// getImageDuplicates reports the groups of identical images
+func (h *HttpHandler) getImageDuplicates(ctx *fasthttp.RequestCtx) {
+	h.writeImageDuplicates(ctx, imageDuplicatesReport{})
+}
+
+// backfillImageDuplicates hashes the images uploaded before the hashes were
+// tracked and reports the groups of identical images
+func (h *HttpHandler) backfillImageDuplicates(ctx *fasthttp.RequestCtx) {
+	backfilled, err := h.backfillImageHashes()
+	if err != nil {
+		logrus.Error("failed to backfill image hashes: ", err.Error())
+		writeError(ctx, "failed to backfill image hashes", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	h.writeImageDuplicates(ctx, imageDuplicatesReport{Backfilled: backfilled})
+}
+
+func (h *HttpHandler) writeImageDuplicates(ctx *fasthttp.RequestCtx, report imageDuplicatesReport) {
+	groups, err := h.imageHashesTable.GetDuplicates()
+	if err != nil {
+		logrus.Error("failed to get image duplicates: ", err.Error())
+		writeError(ctx, "failed to get image duplicates", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	report.Groups = groups
+	if report.Groups == nil {
+		report.Groups = []repo.DuplicateGroup{}
+	}
+
+	writeObject(ctx, report, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) backfillImageHashes() (int, error) {
+	images, err := h.storage.GetImages("")
+	if err != nil {
+		return 0, err
+	}
+
+	hashedNames, err := h.imageHashesTable.GetHashedNames()
+	if err != nil {
+		return 0, err
+	}
+
+	hashed := make(map[string]bool, len(hashedNames))
+	for _, name := range hashedNames {
+		hashed[name] = true
+	}
+
+	var count int
+	for _, name := range images {
+		if hashed[name] {
+			continue
+		}
+
+		data, err := h.storage.GetImage(name)
+		if err != nil {
+			return count, err
+		}
+
+		// images stored before the uploads were sanitized are hashed in the same form as new uploads
+		sanitized, _, err := imaging.Sanitize(data)
+		if err != nil {
+			logrus.Errorf("failed to sanitize image %s, skipping it: %s", name, err.Error())
+			continue
+		}
+
+		err = h.imageHashesTable.Upsert(name, imageHash(sanitized), len(sanitized))
+		if err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
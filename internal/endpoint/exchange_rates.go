@@ -0,0 +1,135 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/cbr"
+	"paint-backend/internal/repo"
+	"time"
+)
+
+type cbrImportReport struct {
+	Date     time.Time `json:"date"`
+	Imported []string  `json:"imported"`
+	Skipped  []string  `json:"skipped"`
+}
+
+func (h *HttpHandler) getExchangeRates(ctx *fasthttp.RequestCtx) {
+	rates, err := h.exchangeRatesTable.GetAll()
+	if err != nil {
+		logrus.Error("failed to get exchange rates: ", err.Error())
+		writeError(ctx, "failed to get exchange rates", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if rates == nil {
+		rates = []repo.ExchangeRate{}
+	}
+
+	writeObject(ctx, rates, fasthttp.StatusOK)
+}
+
+// insertExchangeRate stores the passed rates, replacing the ones of the same pair and date
+func (h *HttpHandler) insertExchangeRate(ctx *fasthttp.RequestCtx) {
+	var rates []repo.ExchangeRate
+	err := json.Unmarshal(ctx.PostBody(), &rates)
+	if err != nil {
+		writeError(ctx, "failed to parse exchange rates", fasthttp.StatusBadRequest)
+		return
+	}
+
+	for i, r := range rates {
+		if r.From == 0 || r.To == 0 || r.From == r.To {
+			writeError(ctx, "exchange rate must be between two different currencies", fasthttp.StatusBadRequest)
+			return
+		}
+
+		if r.Rate.Sign() <= 0 {
+			writeError(ctx, "exchange rate must be positive", fasthttp.StatusBadRequest)
+			return
+		}
+
+		if r.EffectiveDate.IsZero() {
+			writeError(ctx, "empty effective date", fasthttp.StatusBadRequest)
+			return
+		}
+
+		// the date is taken as written, whatever the offset of the passed time is
+		year, month, day := r.EffectiveDate.Date()
+		rates[i].EffectiveDate = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	err = h.exchangeRatesTable.Upsert(rates)
+	if err != nil {
+		logrus.Error("failed to insert exchange rates: ", err.Error())
+		writeError(ctx, "failed to insert exchange rates", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) deleteExchangeRate(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = h.exchangeRatesTable.Delete(uint(id))
+	if err != nil {
+		logrus.Error("failed to delete exchange rate: ", err.Error())
+		writeError(ctx, "failed to delete exchange rate", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+// importCbrRates stores the rubles rates of the known currencies from the
+// Central Bank of Russia XML_daily.asp document passed as the body
+func (h *HttpHandler) importCbrRates(ctx *fasthttp.RequestCtx) {
+	daily, err := cbr.ParseDaily(bytes.NewReader(ctx.PostBody()))
+	if err != nil {
+		writeError(ctx, "failed to parse rates: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	currencies, err := h.currencyTable.GetAllCurrency()
+	if err != nil {
+		logrus.Error("failed to get all currencies: ", err.Error())
+		writeError(ctx, "failed to get currencies", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ruble, ok := findCurrency(currencies, cbr.RubleCode)
+	if !ok {
+		writeError(ctx, "ruble currency is not configured", fasthttp.StatusConflict)
+		return
+	}
+
+	report := cbrImportReport{Date: daily.Date, Imported: []string{}, Skipped: []string{}}
+
+	var rates []repo.ExchangeRate
+	for _, r := range daily.Rates {
+		c, ok := findCurrency(currencies, r.Code)
+		if !ok || c.Id == ruble.Id {
+			report.Skipped = append(report.Skipped, r.Code)
+			continue
+		}
+
+		rates = append(rates, repo.ExchangeRate{From: c.Id, To: ruble.Id, Rate: repo.RateOf(r.Value), EffectiveDate: daily.Date})
+		report.Imported = append(report.Imported, r.Code)
+	}
+
+	err = h.exchangeRatesTable.Upsert(rates)
+	if err != nil {
+		logrus.Error("failed to insert exchange rates: ", err.Error())
+		writeError(ctx, "failed to insert exchange rates", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, report, fasthttp.StatusOK)
+}
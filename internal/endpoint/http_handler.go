@@ -2,10 +2,16 @@ package endpoint
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 	"github.com/valyala/fasthttp"
 	"net/http"
+	"net/url"
+	"paint-backend/internal/imaging"
+	"paint-backend/internal/reconcile"
 	"paint-backend/internal/repo"
 	"paint-backend/internal/s3"
 	"paint-backend/internal/util/cast"
@@ -14,7 +20,8 @@ import (
 )
 
 const (
-	maxImageSizeInBytes = 1024 * 1024 * 10
+	maxImageSizeInBytes    = 1024 * 1024 * 10
+	maxDocumentSizeInBytes = 1024 * 1024 * 20
 )
 
 func init() {
@@ -45,6 +52,171 @@ var routingMap = map[string]route{
 		},
 	},
 
+	"/api/v1/products/detail": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getProductDetail(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/products/documents": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getProductDocuments(ctx)
+			case fasthttp.MethodPost:
+				h.insertProductDocument(ctx)
+			case fasthttp.MethodDelete:
+				h.deleteProductDocument(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/products/search-by-color": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.searchProductsByColor(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/products/price-history": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getPriceHistory(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/reports/price-changes": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getPriceChanges(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/price-batches": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getPriceBatches(ctx)
+			case fasthttp.MethodPost:
+				h.insertPriceBatch(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/price-batches/preview": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.previewPriceBatch(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/price-batches/cancel": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.cancelPriceBatch(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/products/tags": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getProductTags(ctx)
+			case fasthttp.MethodPut:
+				h.setProductTags(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/tags": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getAllTags(ctx)
+			case fasthttp.MethodPut:
+				h.insertTag(ctx)
+			case fasthttp.MethodDelete:
+				h.deleteTag(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/collections": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getAllCollections(ctx, true)
+			case fasthttp.MethodPut:
+				h.insertCollection(ctx)
+			case fasthttp.MethodDelete:
+				h.deleteCollection(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/collections/item": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getCollection(ctx, true)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	// lists drafts and unpublished collections for the admin UI, it has no access control
+	// of its own, so restrict it at the proxy
+	"/api/v1/admin/collections": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				if ctx.QueryArgs().Has("id") {
+					h.getCollection(ctx, false)
+				} else {
+					h.getAllCollections(ctx, false)
+				}
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
 	"/api/v1/currency": {
 		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
 			switch cast.ByteArrayToString(ctx.Method()) {
@@ -60,6 +232,30 @@ var routingMap = map[string]route{
 		},
 	},
 
+	"/api/v1/exchange-rates": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getExchangeRates(ctx)
+			case fasthttp.MethodPut:
+				h.insertExchangeRate(ctx)
+			case fasthttp.MethodDelete:
+				h.deleteExchangeRate(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+	"/api/v1/exchange-rates/import": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.importCbrRates(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
 	"/api/v1/images": {
 		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
 			switch cast.ByteArrayToString(ctx.Method()) {
@@ -75,6 +271,65 @@ var routingMap = map[string]route{
 		},
 	},
 
+	"/api/v1/images/variants": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getImageVariants(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/images/render": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.renderImage(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/images/duplicates": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getImageDuplicates(ctx)
+			case fasthttp.MethodPost:
+				h.backfillImageDuplicates(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/images/reconcile": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.reconcileImages(ctx, false)
+			case fasthttp.MethodPost:
+				h.reconcileImages(ctx, true)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/images/reconcile/restore": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.restoreImage(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
 	"/api/v1/images/folders": {
 		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
 			switch cast.ByteArrayToString(ctx.Method()) {
@@ -86,6 +341,17 @@ var routingMap = map[string]route{
 		},
 	},
 
+	"/api/v1/visualizer": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.visualize(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
 	"/api/v1/brands": {
 		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
 			switch cast.ByteArrayToString(ctx.Method()) {
@@ -93,6 +359,8 @@ var routingMap = map[string]route{
 				h.getAllBrands(ctx)
 			case fasthttp.MethodPost:
 				h.insertBrand(ctx)
+			case fasthttp.MethodPut:
+				h.updateBrand(ctx)
 			case fasthttp.MethodDelete:
 				h.deleteBrand(ctx)
 			default:
@@ -101,6 +369,28 @@ var routingMap = map[string]route{
 		},
 	},
 
+	"/api/v1/brands/page": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getBrandPage(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/brands/merge": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.mergeBrands(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
 	"/api/v1/brands-by-subject": {
 		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
 			switch cast.ByteArrayToString(ctx.Method()) {
@@ -110,6 +400,17 @@ var routingMap = map[string]route{
 		},
 	},
 
+	"/api/v1/subjects-brands/rebuild": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.rebuildSubjectsBrands(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
 	"/api/v1/subjects": {
 		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
 			switch cast.ByteArrayToString(ctx.Method()) {
@@ -139,25 +440,98 @@ var routingMap = map[string]route{
 			}
 		},
 	},
+
+	"/api/v1/subjects/move": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPost:
+				h.moveSubject(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/subjects/reorder": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodPut:
+				h.reorderSubjects(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v1/breadcrumbs": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getBreadcrumbs(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
+
+	"/api/v2/subjects/tree": {
+		handler: func(ctx *fasthttp.RequestCtx, h *HttpHandler) {
+			switch cast.ByteArrayToString(ctx.Method()) {
+			case fasthttp.MethodGet:
+				h.getSubjectsTree(ctx)
+			default:
+				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			}
+		},
+	},
 }
 
 type HttpHandler struct {
-	storage           *s3.Storage
-	productsTable     *repo.ProductsTable
-	currencyTable     *repo.CurrencyTable
-	subjectsTable     *repo.SubjectsTable
-	brandsTable       *repo.BrandsTable
-	subjectBrandTable *repo.SubjectBrandTable
+	storage               *s3.Storage
+	productsTable         *repo.ProductsTable
+	currencyTable         *repo.CurrencyTable
+	subjectsTable         *repo.SubjectsTable
+	brandsTable           *repo.BrandsTable
+	subjectBrandTable     *repo.SubjectBrandTable
+	productDocumentsTable *repo.ProductDocumentsTable
+	tagsTable             *repo.TagsTable
+	collectionsTable      *repo.CollectionsTable
+	imagePalettesTable    *repo.ImagePalettesTable
+	exchangeRatesTable    *repo.ExchangeRatesTable
+	priceHistoryTable     *repo.PriceHistoryTable
+	priceBatchesTable     *repo.PriceBatchesTable
+	imageHashesTable      *repo.ImageHashesTable
+	reconciler            *reconcile.Reconciler
+
+	maxSubjectDepth int
+	imageVariants   []int
+	renderWidths    []int
+	renderHeights   []int
+	imageRules      map[string]imaging.Rule
 }
 
-func NewHttpHandler(storage *s3.Storage, productsTable *repo.ProductsTable, currencyTable *repo.CurrencyTable, subjectsTable *repo.SubjectsTable, brandsTable *repo.BrandsTable, subjectBrandTable *repo.SubjectBrandTable) *HttpHandler {
+func NewHttpHandler(storage *s3.Storage, productsTable *repo.ProductsTable, currencyTable *repo.CurrencyTable, subjectsTable *repo.SubjectsTable, brandsTable *repo.BrandsTable, subjectBrandTable *repo.SubjectBrandTable, productDocumentsTable *repo.ProductDocumentsTable, tagsTable *repo.TagsTable, collectionsTable *repo.CollectionsTable, imagePalettesTable *repo.ImagePalettesTable, exchangeRatesTable *repo.ExchangeRatesTable, priceHistoryTable *repo.PriceHistoryTable, priceBatchesTable *repo.PriceBatchesTable, imageHashesTable *repo.ImageHashesTable, imageReferencesTable *repo.ImageReferencesTable) *HttpHandler {
 	return &HttpHandler{
-		storage:           storage,
-		productsTable:     productsTable,
-		currencyTable:     currencyTable,
-		subjectsTable:     subjectsTable,
-		brandsTable:       brandsTable,
-		subjectBrandTable: subjectBrandTable,
+		storage:               storage,
+		productsTable:         productsTable,
+		currencyTable:         currencyTable,
+		subjectsTable:         subjectsTable,
+		brandsTable:           brandsTable,
+		subjectBrandTable:     subjectBrandTable,
+		productDocumentsTable: productDocumentsTable,
+		tagsTable:             tagsTable,
+		collectionsTable:      collectionsTable,
+		imagePalettesTable:    imagePalettesTable,
+		exchangeRatesTable:    exchangeRatesTable,
+		priceHistoryTable:     priceHistoryTable,
+		priceBatchesTable:     priceBatchesTable,
+		imageHashesTable:      imageHashesTable,
+		reconciler:            reconcile.NewReconciler(storage, imageReferencesTable, imagePalettesTable, imageHashesTable),
+		maxSubjectDepth:       viper.GetInt("subjects.maxDepth"),
+		imageVariants:         viper.GetIntSlice("images.variants"),
+		renderWidths:          viper.GetIntSlice("images.render.widths"),
+		renderHeights:         viper.GetIntSlice("images.render.heights"),
+		imageRules:            loadImageRules(),
 	}
 }
 
@@ -211,6 +585,22 @@ func (h *HttpHandler) getAllProducts(ctx *fasthttp.RequestCtx) {
 		searchOptions.Brand = cast.ByteArrayToString(brandBytes)
 	}
 
+	tagsBytes := ctx.QueryArgs().Peek("tags")
+	if len(tagsBytes) != 0 {
+		searchOptions.TagsFilter = true
+		searchOptions.Tags, err = parseUintList(cast.ByteArrayToString(tagsBytes))
+		if err != nil {
+			writeError(ctx, "failed to parse tags: "+err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	priceOptions, err := parsePriceOptions(ctx)
+	if err != nil {
+		writeError(ctx, "failed to parse price options: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
 	products, err := h.productsTable.GetAllProducts(offset, limit, searchOptions)
 	if err != nil {
 		logrus.Error("failed to get all products: ", err.Error())
@@ -222,9 +612,97 @@ func (h *HttpHandler) getAllProducts(ctx *fasthttp.RequestCtx) {
 		products = []repo.Product{}
 	}
 
+	err = h.applyPriceOptions(products, priceOptions)
+	if errors.Is(err, errUnknownCurrency) {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to apply price options: ", err.Error())
+		writeError(ctx, "failed to prepare prices", fasthttp.StatusInternalServerError)
+		return
+	}
+
 	writeObject(ctx, products, fasthttp.StatusOK)
 }
 
+type productDetail struct {
+	repo.Product
+	Documents   []repo.ProductDocument `json:"documents"`
+	Tags        []repo.Tag             `json:"tags"`
+	LowestPrice *repo.Money            `json:"lowestPrice"`
+}
+
+func (h *HttpHandler) getProductDetail(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	priceOptions, err := parsePriceOptions(ctx)
+	if err != nil {
+		writeError(ctx, "failed to parse price options: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	product, err := h.productsTable.GetById(uint(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "product not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to get product: ", err.Error())
+		writeError(ctx, "failed to get product", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	products := []repo.Product{product}
+	err = h.applyPriceOptions(products, priceOptions)
+	if errors.Is(err, errUnknownCurrency) {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to apply price options: ", err.Error())
+		writeError(ctx, "failed to prepare prices", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	product = products[0]
+
+	documents, err := h.productDocumentsTable.GetByProductId(product.Id)
+	if err != nil {
+		logrus.Error("failed to get product documents: ", err.Error())
+		writeError(ctx, "failed to get product documents", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if documents == nil {
+		documents = []repo.ProductDocument{}
+	}
+
+	tags, err := h.tagsTable.GetByProductId(product.Id)
+	if err != nil {
+		logrus.Error("failed to get product tags: ", err.Error())
+		writeError(ctx, "failed to get product tags", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []repo.Tag{}
+	}
+
+	lowest, err := h.lowestPrice(product)
+	if err != nil {
+		logrus.Error("failed to get lowest price: ", err.Error())
+		writeError(ctx, "failed to get lowest price", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, productDetail{Product: product, Documents: documents, Tags: tags, LowestPrice: lowest}, fasthttp.StatusOK)
+}
+
 func (h *HttpHandler) insertProduct(ctx *fasthttp.RequestCtx) {
 	editFlagBytes := ctx.QueryArgs().Peek("edit")
 	if len(editFlagBytes) == 0 {
@@ -250,40 +728,35 @@ func (h *HttpHandler) insertProduct(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	err = h.productsTable.Insert(product, editFlag)
-	if err != nil {
-		writeError(ctx, err.Error(), fasthttp.StatusInternalServerError)
+	if product.Discount > 100 {
+		writeError(ctx, "discount must not be greater than 100", fasthttp.StatusBadRequest)
 		return
 	}
 
-	var relatedBrands []uint
-	var brandFound bool
-
-	relatedBrands, err = h.subjectBrandTable.GetBrandIdsBySubjectId(product.SubjectId)
+	err = h.resolveProductCurrency(&product)
+	if errors.Is(err, errUnknownCurrency) {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		logrus.Errorf("failed to get brand ids by subject id %d: %s", product.SubjectId, err.Error())
-		writeError(ctx, "failed to get brand ids by passed subject id", fasthttp.StatusInternalServerError)
+		logrus.Error("failed to resolve currency: ", err.Error())
+		writeError(ctx, "failed to resolve currency", fasthttp.StatusInternalServerError)
 		return
 	}
 
-	for _, brandId := range relatedBrands {
-		if product.BrandId == brandId {
-			brandFound = true
-			break
-		}
+	product.BrandId, err = h.brandsTable.ResolveId(product.BrandId)
+	if err != nil {
+		logrus.Error("failed to resolve brand id: ", err.Error())
+		writeError(ctx, "failed to resolve brand", fasthttp.StatusInternalServerError)
+		return
 	}
 
-	if !brandFound {
-		err = h.subjectBrandTable.Insert(repo.SubjectBrand{
-			SubjectId: product.SubjectId,
-			BrandId:   product.BrandId,
-		})
+	h.fillProductPalettes(&product)
 
-		if err != nil {
-			logrus.Error("failed to insert subject brand: ", err.Error())
-			writeError(ctx, "failed to insert subject brand", fasthttp.StatusInternalServerError)
-			return
-		}
+	err = h.productsTable.Insert(product, editFlag)
+	if err != nil {
+		writeError(ctx, err.Error(), fasthttp.StatusInternalServerError)
+		return
 	}
 
 	ctx.SetStatusCode(fasthttp.StatusOK)
@@ -296,6 +769,13 @@ func (h *HttpHandler) deleteProduct(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	documents, err := h.productDocumentsTable.GetByProductId(uint(id))
+	if err != nil {
+		logrus.Error("failed to get product documents: ", err.Error())
+		writeError(ctx, "failed to delete product", fasthttp.StatusInternalServerError)
+		return
+	}
+
 	err = h.productsTable.Delete(uint(id))
 	if err != nil {
 		logrus.Error("failed to delete product: ", err.Error())
@@ -303,6 +783,13 @@ func (h *HttpHandler) deleteProduct(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	for _, document := range documents {
+		err = h.storage.DeleteDocument(document.File)
+		if err != nil {
+			logrus.Errorf("failed to delete document file %s: %s", document.File, err.Error())
+		}
+	}
+
 	ctx.SetStatusCode(fasthttp.StatusOK)
 }
 
@@ -341,6 +828,17 @@ func (h *HttpHandler) insertCurrency(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	currency.Code = strings.ToUpper(currency.Code)
+	if !currencyCodeRegexp.MatchString(currency.Code) {
+		writeError(ctx, "currency code must be a three letter ISO 4217 code", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if currency.MinorUnits > maxCurrencyMinorUnits {
+		writeError(ctx, "too many currency minor units", fasthttp.StatusBadRequest)
+		return
+	}
+
 	err = h.currencyTable.Insert(currency, editFlag)
 	if err != nil {
 		logrus.Error("failed to insert currency: ", err.Error())
@@ -370,6 +868,11 @@ func (h *HttpHandler) deleteCurrency(ctx *fasthttp.RequestCtx) {
 
 func (h *HttpHandler) getAllImages(ctx *fasthttp.RequestCtx) {
 	path := cast.ByteArrayToString(ctx.QueryArgs().Peek("path"))
+	if ctx.QueryArgs().GetBool("variants") {
+		h.getAllImagesWithVariants(ctx, strings.Join(strings.Split(path, ","), "/"))
+		return
+	}
+
 	images, err := h.storage.GetImages(strings.Join(strings.Split(path, ","), "/"))
 	if err != nil {
 		logrus.Error("failed to get all images: ", err.Error())
@@ -407,18 +910,80 @@ func (h *HttpHandler) insertImage(ctx *fasthttp.RequestCtx) {
 	}
 
 	mimeType := http.DetectContentType(body)
-	if mimeType != "image/png" && mimeType != "image/jpeg" {
-		writeError(ctx, fmt.Sprintf("Invalid image type: %s. Allowed only jpeg and png", mimeType), fasthttp.StatusBadRequest)
+	if !imaging.SupportedMime(mimeType) {
+		writeError(ctx, fmt.Sprintf("Invalid image type: %s. Allowed only jpeg, png, gif and webp", mimeType), fasthttp.StatusBadRequest)
+		return
+	}
+
+	// decode the whole image, so truncated and malformed files never get into the bucket
+	img, format, err := imaging.Decode(body)
+	if err != nil {
+		writeError(ctx, "Invalid image: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	if "image/"+format != mimeType {
+		writeError(ctx, fmt.Sprintf("Image content %s doesn't match its type %s", format, mimeType), fasthttp.StatusBadRequest)
+		return
+	}
+
+	// the stored image is rotated according to its EXIF orientation
+	img = imaging.Orient(img, imaging.Orientation(body))
+
+	err = h.imageRule(name).Check(img.Bounds())
+	if err != nil {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	// metadata is stripped before hashing, so uploads that differ only in it are duplicates
+	sanitized, sanitizedFormat, err := imaging.Sanitize(body)
+	if err != nil {
+		writeError(ctx, "Invalid image: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	hash := imageHash(sanitized)
+	duplicate, err := h.findDuplicate(name, hash)
+	if err != nil {
+		logrus.Error("failed to look for image duplicates: ", err.Error())
+		writeError(ctx, "failed to insert image", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if len(duplicate) != 0 {
+		ctx.Response.Header.Set(imageDuplicateHeader, duplicate)
+		ctx.Response.Header.Set("Access-Control-Expose-Headers", imageDuplicateHeader)
+		writeObject(ctx, duplicate, fasthttp.StatusOK)
+		return
+	}
+
+	err = h.storage.InsertOriginal(name, mimeType, body)
+	if err != nil {
+		logrus.Error("failed to insert original image: ", err.Error())
+		writeError(ctx, "failed to insert image", fasthttp.StatusInternalServerError)
 		return
 	}
 
-	err := h.storage.InsertImage(name, mimeType, body)
+	err = h.storage.InsertImage(name, sanitizedFormat, sanitized)
 	if err != nil {
 		logrus.Error("failed to insert image: ", err.Error())
 		writeError(ctx, "failed to insert image", fasthttp.StatusInternalServerError)
 		return
 	}
 
+	err = h.imageHashesTable.Upsert(name, hash, len(sanitized))
+	if err != nil {
+		logrus.Errorf("failed to save hash of image %s: %s", name, err.Error())
+	}
+
+	_, err = h.savePalette(name, img)
+	if err != nil {
+		logrus.Errorf("failed to save palette of image %s: %s", name, err.Error())
+	}
+
+	h.saveVariants(name, img, format)
+
 	writeObject(ctx, name, fasthttp.StatusOK)
 }
 
@@ -438,6 +1003,16 @@ func (h *HttpHandler) deleteImage(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	err = h.imagePalettesTable.Delete(name)
+	if err != nil {
+		logrus.Errorf("failed to delete palette of image %s: %s", name, err.Error())
+	}
+
+	err = h.imageHashesTable.Delete(name)
+	if err != nil {
+		logrus.Errorf("failed to delete hash of image %s: %s", name, err.Error())
+	}
+
 	ctx.SetStatusCode(fasthttp.StatusOK)
 }
 
@@ -462,20 +1037,34 @@ func (h *HttpHandler) getBrandsBySubject(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	brands, err := h.subjectBrandTable.GetBrandIdsBySubjectId(uint(id))
+	descendants := ctx.QueryArgs().GetBool("descendants")
+	inStock := ctx.QueryArgs().GetBool("in_stock")
+
+	brands, err := h.brandsTable.GetBySubject(uint(id), descendants, inStock)
 	if err != nil {
 		logrus.Error("failed to get brands by subject id: ", err.Error())
-		writeError(ctx, "failed to get brand ids by subject id", fasthttp.StatusInternalServerError)
+		writeError(ctx, "failed to get brands by subject id", fasthttp.StatusInternalServerError)
 		return
 	}
 
 	if brands == nil {
-		brands = []uint{}
+		brands = []repo.BrandWithCount{}
 	}
 
 	writeObject(ctx, brands, fasthttp.StatusOK)
 }
 
+func (h *HttpHandler) rebuildSubjectsBrands(ctx *fasthttp.RequestCtx) {
+	report, err := h.subjectBrandTable.Rebuild()
+	if err != nil {
+		logrus.Error("failed to rebuild subjects brands: ", err.Error())
+		writeError(ctx, "failed to rebuild subjects brands", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, report, fasthttp.StatusOK)
+}
+
 func (h *HttpHandler) insertBrand(ctx *fasthttp.RequestCtx) {
 	var brand repo.Brand
 	err := json.Unmarshal(ctx.PostBody(), &brand)
@@ -484,6 +1073,10 @@ func (h *HttpHandler) insertBrand(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	if !h.validateBrand(ctx, &brand) {
+		return
+	}
+
 	err = h.brandsTable.Insert(brand)
 	if err != nil {
 		logrus.Error("failed to insert brand: ", err.Error())
@@ -494,6 +1087,119 @@ func (h *HttpHandler) insertBrand(ctx *fasthttp.RequestCtx) {
 	ctx.SetStatusCode(fasthttp.StatusOK)
 }
 
+func (h *HttpHandler) updateBrand(ctx *fasthttp.RequestCtx) {
+	var brand repo.Brand
+	err := json.Unmarshal(ctx.PostBody(), &brand)
+	if err != nil {
+		writeError(ctx, "failed to parse brand", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if !h.validateBrand(ctx, &brand) {
+		return
+	}
+
+	err = h.brandsTable.Update(brand)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "brand not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to update brand: ", err.Error())
+		writeError(ctx, "failed to update brand", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) validateBrand(ctx *fasthttp.RequestCtx, brand *repo.Brand) bool {
+	brand.Name = strings.TrimSpace(brand.Name)
+	if len(brand.Name) == 0 {
+		writeError(ctx, "empty name", fasthttp.StatusBadRequest)
+		return false
+	}
+
+	if len(brand.Website) != 0 {
+		website, err := url.Parse(brand.Website)
+		if err != nil || (website.Scheme != "http" && website.Scheme != "https") || len(website.Host) == 0 {
+			writeError(ctx, "invalid website, expected http or https url", fasthttp.StatusBadRequest)
+			return false
+		}
+	}
+
+	if len(brand.Logo) != 0 {
+		exists, err := h.storage.ImageExists(brand.Logo)
+		if err != nil {
+			logrus.Error("failed to check brand logo: ", err.Error())
+			writeError(ctx, "failed to check brand logo", fasthttp.StatusInternalServerError)
+			return false
+		}
+
+		if !exists {
+			writeError(ctx, "logo image not found", fasthttp.StatusBadRequest)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *HttpHandler) getBrandPage(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	page, err := h.brandsTable.GetPage(uint(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "brand not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to get brand page: ", err.Error())
+		writeError(ctx, "failed to get brand page", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, page, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) mergeBrands(ctx *fasthttp.RequestCtx) {
+	var request repo.BrandMergeRequest
+	err := json.Unmarshal(ctx.PostBody(), &request)
+	if err != nil {
+		writeError(ctx, "failed to parse merge request", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if request.Target == 0 || len(request.Sources) == 0 {
+		writeError(ctx, "target and sources must be passed", fasthttp.StatusBadRequest)
+		return
+	}
+
+	report, err := h.brandsTable.Merge(request, ctx.QueryArgs().GetBool("dry_run"))
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(ctx, "some of the brands not found", fasthttp.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrMergeIntoItself):
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	case err != nil:
+		logrus.Error("failed to merge brands: ", err.Error())
+		writeError(ctx, "failed to merge brands", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, report, fasthttp.StatusOK)
+}
+
+type brandDeleteReport struct {
+	CancelledPriceBatches []uint `json:"cancelledPriceBatches"`
+}
+
 func (h *HttpHandler) deleteBrand(ctx *fasthttp.RequestCtx) {
 	id, err := ctx.QueryArgs().GetUint("id")
 	if err != nil {
@@ -501,14 +1207,14 @@ func (h *HttpHandler) deleteBrand(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	err = h.brandsTable.Delete(uint(id))
+	cancelled, err := h.brandsTable.Delete(uint(id))
 	if err != nil {
 		logrus.Error("failed to delete brand: ", err.Error())
 		writeError(ctx, "failed to delete brand", fasthttp.StatusInternalServerError)
 		return
 	}
 
-	ctx.SetStatusCode(fasthttp.StatusOK)
+	writeObject(ctx, brandDeleteReport{CancelledPriceBatches: cancelled}, fasthttp.StatusOK)
 }
 
 func (h *HttpHandler) getAllSubjects(ctx *fasthttp.RequestCtx) {
@@ -541,6 +1247,154 @@ func (h *HttpHandler) getAllSubjectsV2(ctx *fasthttp.RequestCtx) {
 	writeObject(ctx, subjects, fasthttp.StatusOK)
 }
 
+func (h *HttpHandler) getSubjectsTree(ctx *fasthttp.RequestCtx) {
+	var root, maxDepth int
+	var err error
+
+	if ctx.QueryArgs().Has("root") {
+		root, err = ctx.QueryArgs().GetUint("root")
+		if err != nil {
+			writeError(ctx, "failed to parse root", fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	if ctx.QueryArgs().Has("maxDepth") {
+		maxDepth, err = ctx.QueryArgs().GetUint("maxDepth")
+		if err != nil {
+			writeError(ctx, "failed to parse max depth", fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	tree, err := h.subjectsTable.GetTree(uint(root), maxDepth)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "root subject not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to get subjects tree: ", err.Error())
+		writeError(ctx, "failed to get subjects tree", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, tree, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) moveSubject(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	var parentId int
+	if ctx.QueryArgs().Has("parent_id") {
+		parentId, err = ctx.QueryArgs().GetUint("parent_id")
+		if err != nil {
+			writeError(ctx, "failed to parse parent id", fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	subtree := true
+	if ctx.QueryArgs().Has("subtree") {
+		subtree = ctx.QueryArgs().GetBool("subtree")
+	}
+
+	report, err := h.subjectsTable.Move(uint(id), uint(parentId), subtree, h.maxSubjectDepth)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(ctx, "subject or parent not found", fasthttp.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrSubjectCycle), errors.Is(err, repo.ErrSubjectTooDeep):
+		writeError(ctx, err.Error(), fasthttp.StatusConflict)
+		return
+	case err != nil:
+		logrus.Error("failed to move subject: ", err.Error())
+		writeError(ctx, "failed to move subject", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, report, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) reorderSubjects(ctx *fasthttp.RequestCtx) {
+	var parentId int
+	var err error
+
+	if ctx.QueryArgs().Has("parent_id") {
+		parentId, err = ctx.QueryArgs().GetUint("parent_id")
+		if err != nil {
+			writeError(ctx, "failed to parse parent id", fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	var ids []uint
+	err = json.Unmarshal(ctx.PostBody(), &ids)
+	if err != nil {
+		writeError(ctx, "failed to parse subject ids", fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = h.subjectsTable.Reorder(uint(parentId), ids)
+	if errors.Is(err, repo.ErrOrderMismatch) {
+		writeError(ctx, err.Error(), fasthttp.StatusConflict)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to reorder subjects: ", err.Error())
+		writeError(ctx, "failed to reorder subjects", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) getBreadcrumbs(ctx *fasthttp.RequestCtx) {
+	var breadcrumbs []repo.Breadcrumb
+
+	switch {
+	case ctx.QueryArgs().Has("subject_id"):
+		id, err := ctx.QueryArgs().GetUint("subject_id")
+		if err != nil {
+			writeError(ctx, "failed to parse subject id", fasthttp.StatusBadRequest)
+			return
+		}
+
+		breadcrumbs, err = h.subjectsTable.GetAncestors(uint(id))
+		if err != nil {
+			logrus.Error("failed to get subject ancestors: ", err.Error())
+			writeError(ctx, "failed to get breadcrumbs", fasthttp.StatusInternalServerError)
+			return
+		}
+	case ctx.QueryArgs().Has("product_id"):
+		id, err := ctx.QueryArgs().GetUint("product_id")
+		if err != nil {
+			writeError(ctx, "failed to parse product id", fasthttp.StatusBadRequest)
+			return
+		}
+
+		breadcrumbs, err = h.subjectsTable.GetProductAncestors(uint(id))
+		if err != nil {
+			logrus.Error("failed to get product ancestors: ", err.Error())
+			writeError(ctx, "failed to get breadcrumbs", fasthttp.StatusInternalServerError)
+			return
+		}
+	default:
+		writeError(ctx, "either subject_id or product_id must be passed", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if len(breadcrumbs) == 0 {
+		writeError(ctx, "subject not found", fasthttp.StatusNotFound)
+		return
+	}
+
+	writeObject(ctx, breadcrumbs, fasthttp.StatusOK)
+}
+
 func (h *HttpHandler) insertSubject(ctx *fasthttp.RequestCtx) {
 	var subject repo.Subject
 	err := json.Unmarshal(ctx.PostBody(), &subject)
@@ -549,8 +1403,15 @@ func (h *HttpHandler) insertSubject(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	err = h.subjectsTable.Insert(subject)
-	if err != nil {
+	err = h.subjectsTable.Insert(subject, h.maxSubjectDepth)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(ctx, "parent subject not found", fasthttp.StatusBadRequest)
+		return
+	case errors.Is(err, repo.ErrSubjectTooDeep):
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	case err != nil:
 		logrus.Error("failed to insert subject: ", err.Error())
 		writeError(ctx, "failed to insert subject", fasthttp.StatusInternalServerError)
 		return
@@ -566,14 +1427,80 @@ func (h *HttpHandler) deleteSubject(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	err = h.subjectsTable.Delete(uint(id))
-	if err != nil {
+	options := repo.SubjectDeleteOptions{
+		Mode:  repo.DeleteRestrict,
+		Token: cast.ByteArrayToString(ctx.QueryArgs().Peek("token")),
+	}
+
+	if modeBytes := ctx.QueryArgs().Peek("mode"); len(modeBytes) != 0 {
+		options.Mode = repo.SubjectDeleteMode(cast.ByteArrayToString(modeBytes))
+	}
+
+	if !options.Mode.Valid() {
+		writeError(ctx, fmt.Sprintf("Invalid mode: %s. Allowed only %s, %s and %s", options.Mode, repo.DeleteRestrict, repo.DeleteReassign, repo.DeleteCascade), fasthttp.StatusBadRequest)
+		return
+	}
+
+	if ctx.QueryArgs().Has("target") {
+		var target int
+		target, err = ctx.QueryArgs().GetUint("target")
+		if err != nil {
+			writeError(ctx, "failed to parse target", fasthttp.StatusBadRequest)
+			return
+		}
+
+		options.Target = uint(target)
+	}
+
+	var report repo.SubjectDeletePreview
+	if ctx.QueryArgs().GetBool("preview") {
+		report, err = h.subjectsTable.PreviewDelete(uint(id), options, h.maxSubjectDepth)
+	} else {
+		report, err = h.subjectsTable.Delete(uint(id), options, h.maxSubjectDepth)
+	}
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(ctx, "subject or target not found", fasthttp.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrNoReassignTarget):
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	case errors.Is(err, repo.ErrSubjectHasProducts), errors.Is(err, repo.ErrInvalidConfirmation),
+		errors.Is(err, repo.ErrSubjectCycle), errors.Is(err, repo.ErrSubjectTooDeep):
+		writeError(ctx, err.Error(), fasthttp.StatusConflict)
+		return
+	case err != nil:
 		logrus.Error("failed to delete subject: ", err.Error())
 		writeError(ctx, "failed to delete subject", fasthttp.StatusInternalServerError)
 		return
 	}
 
-	ctx.SetStatusCode(fasthttp.StatusOK)
+	if !ctx.QueryArgs().GetBool("preview") {
+		for _, file := range report.Documents {
+			err = h.storage.DeleteDocument(file)
+			if err != nil {
+				logrus.Errorf("failed to delete document file %s: %s", file, err.Error())
+			}
+		}
+	}
+
+	writeObject(ctx, report, fasthttp.StatusOK)
+}
+
+func parseUintList(str string) ([]uint, error) {
+	split := strings.Split(str, ",")
+	res := make([]uint, 0, len(split))
+	for _, item := range split {
+		value, err := strconv.ParseUint(strings.TrimSpace(item), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, uint(value))
+	}
+
+	return res, nil
 }
 
 type errorResponse struct {
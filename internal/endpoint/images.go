@@ -0,0 +1,90 @@
+package endpoint
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/valyala/fasthttp"
+	"image"
+	"paint-backend/internal/imaging"
+	"paint-backend/internal/s3"
+	"paint-backend/internal/util/cast"
+	"strings"
+)
+
+const defaultImageRule = "default"
+
+// saveVariants stores the configured resized variants of the image next to it,
+// skipping the ones that would be wider than the image itself
+func (h *HttpHandler) saveVariants(name string, img image.Image, format string) {
+	for _, width := range h.imageVariants {
+		if width <= 0 || width >= img.Bounds().Dx() {
+			continue
+		}
+
+		data, err := imaging.Encode(imaging.ResizeToWidth(img, width), imaging.EncodingFormat(format))
+		if err != nil {
+			logrus.Errorf("failed to encode %dw variant of image %s: %s", width, name, err.Error())
+			continue
+		}
+
+		_, err = h.storage.InsertImageVariant(name, width, "image/"+imaging.EncodingFormat(format), data)
+		if err != nil {
+			logrus.Errorf("failed to insert %dw variant of image %s: %s", width, name, err.Error())
+		}
+	}
+}
+
+func (h *HttpHandler) getImageVariants(ctx *fasthttp.RequestCtx) {
+	nameBytes := ctx.QueryArgs().Peek("name")
+	if len(nameBytes) == 0 {
+		writeError(ctx, "empty name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	variants, err := h.storage.GetImageVariants(cast.ByteArrayToString(nameBytes))
+	if err != nil {
+		logrus.Error("failed to get image variants: ", err.Error())
+		writeError(ctx, "failed to get image variants", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, variants, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) getAllImagesWithVariants(ctx *fasthttp.RequestCtx, path string) {
+	images, err := h.storage.GetImagesWithVariants(path)
+	if err != nil {
+		logrus.Error("failed to get all images: ", err.Error())
+		writeError(ctx, "failed to get images", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if images == nil {
+		images = []s3.ImageWithVariants{}
+	}
+
+	writeObject(ctx, images, fasthttp.StatusOK)
+}
+
+// loadImageRules reads the per folder image limits, the "default" rule applies to other folders
+func loadImageRules() map[string]imaging.Rule {
+	rules := make(map[string]imaging.Rule)
+	err := viper.UnmarshalKey("images.rules", &rules)
+	if err != nil {
+		logrus.Error("failed to read image rules: ", err.Error())
+	}
+
+	return rules
+}
+
+// imageRule returns the limits of the top level folder of the image
+func (h *HttpHandler) imageRule(name string) imaging.Rule {
+	folder, _, found := strings.Cut(name, "/")
+	if found {
+		if rule, ok := h.imageRules[strings.ToLower(folder)]; ok {
+			return rule
+		}
+	}
+
+	return h.imageRules[defaultImageRule]
+}
@@ -0,0 +1,170 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/repo"
+	"time"
+)
+
+func (h *HttpHandler) getPriceBatches(ctx *fasthttp.RequestCtx) {
+	if ctx.QueryArgs().Has("id") {
+		id, err := ctx.QueryArgs().GetUint("id")
+		if err != nil {
+			writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+			return
+		}
+
+		batch, err := h.priceBatchesTable.GetById(uint(id))
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(ctx, "price batch not found", fasthttp.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logrus.Error("failed to get price batch: ", err.Error())
+			writeError(ctx, "failed to get price batch", fasthttp.StatusInternalServerError)
+			return
+		}
+
+		writeObject(ctx, batch, fasthttp.StatusOK)
+		return
+	}
+
+	batches, err := h.priceBatchesTable.GetAll()
+	if err != nil {
+		logrus.Error("failed to get price batches: ", err.Error())
+		writeError(ctx, "failed to get price batches", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if batches == nil {
+		batches = []repo.PriceBatch{}
+	}
+
+	writeObject(ctx, batches, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) insertPriceBatch(ctx *fasthttp.RequestCtx) {
+	var batch repo.PriceBatch
+	err := json.Unmarshal(ctx.PostBody(), &batch)
+	if err != nil {
+		writeError(ctx, "failed to parse price batch", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if len(batch.Name) == 0 {
+		writeError(ctx, "empty price batch name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if !batch.EffectiveAt.After(time.Now()) {
+		writeError(ctx, "price batch must take effect in the future", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if (len(batch.Items) == 0) == (batch.Percent == nil) {
+		writeError(ctx, "price batch must have either items or a percent rule", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if batch.Percent != nil {
+		if *batch.Percent <= -100 || *batch.Percent == 0 {
+			writeError(ctx, "percent must be non zero and greater than -100", fasthttp.StatusBadRequest)
+			return
+		}
+
+		if (batch.BrandId == 0) == (batch.SubjectId == 0) {
+			writeError(ctx, "percent rule must target either a brand or a subject", fasthttp.StatusBadRequest)
+			return
+		}
+
+		batch.BrandId, err = h.brandsTable.ResolveId(batch.BrandId)
+		if err != nil {
+			logrus.Error("failed to resolve brand id: ", err.Error())
+			writeError(ctx, "failed to resolve brand", fasthttp.StatusInternalServerError)
+			return
+		}
+	} else {
+		seen := make(map[uint]bool, len(batch.Items))
+		for _, item := range batch.Items {
+			if seen[item.ProductId] {
+				writeError(ctx, "duplicate product in price batch", fasthttp.StatusBadRequest)
+				return
+			}
+
+			if item.Price < 0 {
+				writeError(ctx, "price must not be negative", fasthttp.StatusBadRequest)
+				return
+			}
+
+			seen[item.ProductId] = true
+		}
+
+		batch.BrandId, batch.SubjectId = 0, 0
+	}
+
+	id, err := h.priceBatchesTable.Insert(batch)
+	if errors.Is(err, repo.ErrUnknownBatchTarget) {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to insert price batch: ", err.Error())
+		writeError(ctx, "failed to insert price batch", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, id, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) previewPriceBatch(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	changes, err := h.priceBatchesTable.Preview(uint(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "price batch not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to preview price batch: ", err.Error())
+		writeError(ctx, "failed to preview price batch", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if changes == nil {
+		changes = []repo.PriceBatchChange{}
+	}
+
+	writeObject(ctx, changes, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) cancelPriceBatch(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = h.priceBatchesTable.Cancel(uint(id))
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(ctx, "price batch not found", fasthttp.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrBatchNotPending):
+		writeError(ctx, err.Error(), fasthttp.StatusConflict)
+		return
+	case err != nil:
+		logrus.Error("failed to cancel price batch: ", err.Error())
+		writeError(ctx, "failed to cancel price batch", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
@@ -0,0 +1,123 @@
+package endpoint
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/repo"
+	"paint-backend/internal/util/cast"
+	"time"
+)
+
+const defaultPriceHistoryPeriod = 365 * 24 * time.Hour
+
+type priceHistory struct {
+	Entries     []repo.PriceHistoryEntry `json:"entries"`
+	LowestPrice *repo.Money              `json:"lowestPrice"`
+	LowestDays  int                      `json:"lowestPriceDays"`
+}
+
+func (h *HttpHandler) getPriceHistory(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeArg(ctx, "to", time.Now())
+	if err != nil {
+		writeError(ctx, "failed to parse to: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	from, err := parseTimeArg(ctx, "from", to.Add(-defaultPriceHistoryPeriod))
+	if err != nil {
+		writeError(ctx, "failed to parse from: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	product, err := h.productsTable.GetById(uint(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "product not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to get product: ", err.Error())
+		writeError(ctx, "failed to get product", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	entries, err := h.priceHistoryTable.GetByProductId(product.Id, from, to)
+	if err != nil {
+		logrus.Error("failed to get price history: ", err.Error())
+		writeError(ctx, "failed to get price history", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []repo.PriceHistoryEntry{}
+	}
+
+	lowest, err := h.lowestPrice(product)
+	if err != nil {
+		logrus.Error("failed to get lowest price: ", err.Error())
+		writeError(ctx, "failed to get lowest price", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, priceHistory{Entries: entries, LowestPrice: lowest, LowestDays: int(repo.LowestPriceWindow.Hours() / 24)}, fasthttp.StatusOK)
+}
+
+// lowestPrice returns the lowest discounted price of the product in its current
+// currency before the current price took effect
+func (h *HttpHandler) lowestPrice(product repo.Product) (*repo.Money, error) {
+	lowest, ok, err := h.priceHistoryTable.GetLowestPrice(product.Id, product.Currency)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return &lowest, nil
+}
+
+func (h *HttpHandler) getPriceChanges(ctx *fasthttp.RequestCtx) {
+	from, err := parseTimeArg(ctx, "from", time.Time{})
+	if err != nil || from.IsZero() {
+		writeError(ctx, "failed to parse from", fasthttp.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeArg(ctx, "to", time.Now())
+	if err != nil {
+		writeError(ctx, "failed to parse to: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	changes, err := h.priceHistoryTable.GetChanges(from, to)
+	if err != nil {
+		logrus.Error("failed to get price changes: ", err.Error())
+		writeError(ctx, "failed to get price changes", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if changes == nil {
+		changes = []repo.PriceChange{}
+	}
+
+	writeObject(ctx, changes, fasthttp.StatusOK)
+}
+
+// parseTimeArg parses the query argument as a date or an RFC 3339 timestamp
+func parseTimeArg(ctx *fasthttp.RequestCtx, key string, fallback time.Time) (time.Time, error) {
+	value := cast.ByteArrayToString(ctx.QueryArgs().Peek(key))
+	if len(value) == 0 {
+		return fallback, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,156 @@
+package endpoint
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/repo"
+	"paint-backend/internal/util/cast"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxCurrencyMinorUnits = 4
+
+var (
+	errUnknownCurrency = errors.New("currency not found")
+	currencyCodeRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+type priceOptions struct {
+	formatted bool
+	// currency is the code or the id of the currency to convert prices to
+	currency string
+}
+
+// parsePriceOptions reads the optional formatted flag and target currency of the product reads
+func parsePriceOptions(ctx *fasthttp.RequestCtx) (priceOptions, error) {
+	var options priceOptions
+
+	formattedBytes := ctx.QueryArgs().Peek("formatted")
+	if len(formattedBytes) != 0 {
+		var err error
+		options.formatted, err = strconv.ParseBool(cast.ByteArrayToString(formattedBytes))
+		if err != nil {
+			return priceOptions{}, err
+		}
+	}
+
+	options.currency = strings.ToUpper(cast.ByteArrayToString(ctx.QueryArgs().Peek("currency")))
+
+	return options, nil
+}
+
+// applyPriceOptions fills the formatted price strings and the prices converted
+// to the requested currency at the current rates
+func (h *HttpHandler) applyPriceOptions(products []repo.Product, options priceOptions) error {
+	if !options.formatted && len(options.currency) == 0 {
+		return nil
+	}
+
+	currencies, err := h.currencyTable.GetAllCurrency()
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[uint]repo.Currency, len(currencies))
+	for _, c := range currencies {
+		byId[c.Id] = c
+	}
+
+	var target repo.Currency
+	var rates repo.RateSet
+	if len(options.currency) != 0 {
+		var ok bool
+		target, ok = findCurrency(currencies, options.currency)
+		if !ok {
+			return errUnknownCurrency
+		}
+
+		rates, err = h.exchangeRatesTable.GetEffective(time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range products {
+		p := &products[i]
+
+		c, ok := byId[p.Currency]
+		if !ok {
+			continue
+		}
+
+		if options.formatted {
+			p.PriceFormatted = c.Format(p.Price)
+			if p.Discount != 0 {
+				p.DiscountPriceFormatted = c.Format(p.Price.Discount(p.Discount))
+			}
+		}
+
+		if target.Id == 0 {
+			continue
+		}
+
+		conversion, ok := rates.Find(c.Id, target.Id)
+		if !ok {
+			continue
+		}
+
+		converted := &repo.ConvertedPrice{
+			Currency:      target.Id,
+			Rate:          conversion.Rate,
+			Price:         p.Price.Convert(conversion.Rate, target.MinorUnits),
+			DiscountPrice: p.Price.Convert(conversion.Rate.Discount(p.Discount), target.MinorUnits),
+		}
+
+		if !conversion.Date.IsZero() {
+			converted.RateDate = &conversion.Date
+		}
+
+		if options.formatted {
+			converted.PriceFormatted = target.Format(converted.Price)
+			converted.DiscountPriceFormatted = target.Format(converted.DiscountPrice)
+		}
+
+		p.Converted = converted
+	}
+
+	return nil
+}
+
+func findCurrency(currencies []repo.Currency, codeOrId string) (repo.Currency, bool) {
+	id, err := strconv.ParseUint(codeOrId, 10, 64)
+	for _, c := range currencies {
+		if c.Code == codeOrId || err == nil && c.Id == uint(id) {
+			return c, true
+		}
+	}
+
+	return repo.Currency{}, false
+}
+
+// resolveProductCurrency falls back to the default currency when none is passed,
+// makes sure the referenced one exists and rounds the price to its precision
+func (h *HttpHandler) resolveProductCurrency(product *repo.Product) error {
+	var c repo.Currency
+	var err error
+	if product.Currency == 0 {
+		c, err = h.currencyTable.GetDefault()
+	} else {
+		c, err = h.currencyTable.GetById(product.Currency)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errUnknownCurrency
+	}
+	if err != nil {
+		return err
+	}
+
+	product.Currency = c.Id
+	product.Price = product.Price.Round(c.MinorUnits)
+	return nil
+}
@@ -0,0 +1,71 @@
+package endpoint
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/reconcile"
+	"paint-backend/internal/s3"
+	"paint-backend/internal/util/cast"
+	"paint-backend/pkg/fserver"
+)
+
+// reconcileImages reports orphaned objects and dangling references. A cleanup run
+// moves the orphans to the quarantine prefix when quarantine is set and deletes
+// the images quarantined longer than the grace period when purge is set.
+func (h *HttpHandler) reconcileImages(ctx *fasthttp.RequestCtx, cleanup bool) {
+	options := reconcile.LoadOptions()
+	if cleanup {
+		options.Quarantine = ctx.QueryArgs().GetBool("quarantine")
+		options.Purge = ctx.QueryArgs().GetBool("purge")
+	}
+
+	report, err := h.reconciler.Run(options)
+	if err != nil {
+		logrus.Error("failed to reconcile images: ", err.Error())
+		writeError(ctx, "failed to reconcile images", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	writeObject(ctx, report, fasthttp.StatusOK)
+}
+
+// restoreImage brings the quarantined image back together with its variants
+func (h *HttpHandler) restoreImage(ctx *fasthttp.RequestCtx) {
+	nameBytes := ctx.QueryArgs().Peek("name")
+	if len(nameBytes) == 0 {
+		writeError(ctx, "empty name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	name := cast.ByteArrayToString(nameBytes)
+	if s3.IsServiceFile(name) {
+		writeError(ctx, "invalid name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	exists, err := h.storage.ImageExists(name)
+	if err != nil {
+		logrus.Error("failed to check image: ", err.Error())
+		writeError(ctx, "failed to restore image", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if exists {
+		writeError(ctx, "image with this name already exists", fasthttp.StatusConflict)
+		return
+	}
+
+	err = h.storage.RestoreImage(name)
+	if fserver.IsNotFound(err) {
+		writeError(ctx, "image is not in quarantine", fasthttp.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		logrus.Error("failed to restore image: ", err.Error())
+		writeError(ctx, "failed to restore image", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
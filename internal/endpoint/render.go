@@ -0,0 +1,159 @@
+package endpoint
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"image"
+	"io"
+	"paint-backend/internal/imaging"
+	"paint-backend/internal/s3"
+	"paint-backend/internal/util/cast"
+	"paint-backend/pkg/fserver"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the url doesn't change when the original is replaced, so caches revalidate it by the ETag
+	renderCacheControl = "public, max-age=300, must-revalidate"
+	// the url pinned to the version of the original with v never changes its content
+	renderVersionedCacheControl = "public, max-age=31536000, immutable"
+
+	renderVersionHeader = "X-Image-Version"
+)
+
+// renderImage serves the image scaled to one of the allowed sizes. Renditions
+// are cached in the bucket, so every size is rendered only once per original.
+// The version of the original is returned in the X-Image-Version header, passing
+// it as v makes the response cacheable forever.
+func (h *HttpHandler) renderImage(ctx *fasthttp.RequestCtx) {
+	nameBytes := ctx.QueryArgs().Peek("name")
+	if len(nameBytes) == 0 {
+		writeError(ctx, "empty name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	name := cast.ByteArrayToString(nameBytes)
+	if s3.IsServiceFile(name) {
+		writeError(ctx, "image not found", fasthttp.StatusNotFound)
+		return
+	}
+
+	width := ctx.QueryArgs().GetUintOrZero("w")
+	if !slices.Contains(h.renderWidths, width) {
+		writeError(ctx, fmt.Sprintf("width must be one of %v", h.renderWidths), fasthttp.StatusBadRequest)
+		return
+	}
+
+	height := ctx.QueryArgs().GetUintOrZero("h")
+	if height != 0 && !slices.Contains(h.renderHeights, height) {
+		writeError(ctx, fmt.Sprintf("height must be one of %v", h.renderHeights), fasthttp.StatusBadRequest)
+		return
+	}
+
+	fit := imaging.FitCover
+	if fitBytes := ctx.QueryArgs().Peek("fit"); len(fitBytes) != 0 {
+		fit = imaging.FitMode(cast.ByteArrayToString(fitBytes))
+		if !fit.Valid() {
+			writeError(ctx, "fit must be cover or contain", fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	format := strings.ToLower(cast.ByteArrayToString(ctx.QueryArgs().Peek("format")))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+
+	if len(format) != 0 && format != "jpeg" && format != "png" {
+		writeError(ctx, "format must be jpeg or png", fasthttp.StatusBadRequest)
+		return
+	}
+
+	original, err := h.storage.OpenImage(name)
+	if fserver.IsNotFound(err) {
+		writeError(ctx, "image not found", fasthttp.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Error("failed to open image: ", err.Error())
+		writeError(ctx, "failed to get image", fasthttp.StatusInternalServerError)
+		return
+	}
+	defer original.Reader.Close()
+
+	if len(format) == 0 {
+		format = "jpeg"
+		if strings.HasSuffix(strings.ToLower(name), ".png") {
+			format = "png"
+		}
+	}
+
+	rendition := fmt.Sprintf("%dx%d-%s", width, height, fit)
+	key := s3.RenderName(name, rendition, original.LastModified, format)
+	version := strconv.FormatInt(original.LastModified.Unix(), 10)
+	etag := fmt.Sprintf(`"%s-%s"`, rendition, version)
+
+	cacheControl := renderCacheControl
+	if cast.ByteArrayToString(ctx.QueryArgs().Peek("v")) == version {
+		cacheControl = renderVersionedCacheControl
+	}
+
+	ctx.Response.Header.Set(fasthttp.HeaderCacheControl, cacheControl)
+	ctx.Response.Header.Set(fasthttp.HeaderETag, etag)
+	ctx.Response.Header.Set(renderVersionHeader, version)
+	ctx.Response.Header.Set("Access-Control-Expose-Headers", renderVersionHeader)
+	ctx.Response.Header.SetLastModified(original.LastModified)
+
+	if cast.ByteArrayToString(ctx.Request.Header.Peek(fasthttp.HeaderIfNoneMatch)) == etag {
+		ctx.SetStatusCode(fasthttp.StatusNotModified)
+		return
+	}
+
+	data, cached, err := h.storage.GetRender(key)
+	if err != nil {
+		logrus.Error("failed to get cached rendition: ", err.Error())
+	}
+
+	if !cached {
+		data, err = io.ReadAll(original.Reader)
+		if err != nil {
+			logrus.Error("failed to read image: ", err.Error())
+			writeError(ctx, "failed to get image", fasthttp.StatusInternalServerError)
+			return
+		}
+
+		var img image.Image
+		img, _, err = imaging.Decode(data)
+		if err != nil {
+			logrus.Errorf("failed to decode image %s: %s", name, err.Error())
+			writeError(ctx, "failed to decode image", fasthttp.StatusUnprocessableEntity)
+			return
+		}
+
+		var rendered *image.RGBA
+		if height == 0 {
+			rendered = imaging.ResizeToWidth(img, width)
+		} else {
+			rendered = imaging.Fit(img, width, height, fit)
+		}
+
+		data, err = imaging.Encode(rendered, format)
+		if err != nil {
+			logrus.Error("failed to encode rendition: ", err.Error())
+			writeError(ctx, "failed to encode image", fasthttp.StatusInternalServerError)
+			return
+		}
+
+		err = h.storage.InsertRender(key, "image/"+format, data)
+		if err != nil {
+			logrus.Error("failed to cache rendition: ", err.Error())
+		}
+	}
+
+	ctx.Response.Header.Set(fasthttp.HeaderContentType, "image/"+format)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	_, _ = ctx.Write(data)
+}
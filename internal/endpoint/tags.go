@@ -0,0 +1,128 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"paint-backend/internal/repo"
+	"paint-backend/internal/util/cast"
+	"strconv"
+)
+
+func (h *HttpHandler) getAllTags(ctx *fasthttp.RequestCtx) {
+	tags, err := h.tagsTable.GetAll()
+	if err != nil {
+		logrus.Error("failed to get all tags: ", err.Error())
+		writeError(ctx, "failed to get tags", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []repo.Tag{}
+	}
+
+	writeObject(ctx, tags, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) insertTag(ctx *fasthttp.RequestCtx) {
+	editFlagBytes := ctx.QueryArgs().Peek("edit")
+	if len(editFlagBytes) == 0 {
+		writeError(ctx, "empty edit flag", fasthttp.StatusBadRequest)
+		return
+	}
+
+	editFlag, err := strconv.ParseBool(cast.ByteArrayToString(editFlagBytes))
+	if err != nil {
+		writeError(ctx, "failed to parse edit flag: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	var tag repo.Tag
+	err = json.Unmarshal(ctx.PostBody(), &tag)
+	if err != nil {
+		writeError(ctx, "failed to parse tag", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if len(tag.Name) == 0 {
+		writeError(ctx, "empty name", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if !tag.Facet.Valid() {
+		writeError(ctx, fmt.Sprintf("Invalid facet: %s. Allowed only %s, %s and %s", tag.Facet, repo.ApplicationArea, repo.Surface, repo.Environment), fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = h.tagsTable.Insert(tag, editFlag)
+	if err != nil {
+		logrus.Error("failed to insert tag: ", err.Error())
+		writeError(ctx, "failed to insert tag", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) deleteTag(ctx *fasthttp.RequestCtx) {
+	id, err := ctx.QueryArgs().GetUint("id")
+	if err != nil {
+		writeError(ctx, "failed to parse id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = h.tagsTable.Delete(uint(id))
+	if err != nil {
+		logrus.Error("failed to delete tag: ", err.Error())
+		writeError(ctx, "failed to delete tag", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) getProductTags(ctx *fasthttp.RequestCtx) {
+	productId, err := ctx.QueryArgs().GetUint("product_id")
+	if err != nil {
+		writeError(ctx, "failed to parse product id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	tags, err := h.tagsTable.GetByProductId(uint(productId))
+	if err != nil {
+		logrus.Error("failed to get product tags: ", err.Error())
+		writeError(ctx, "failed to get product tags", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []repo.Tag{}
+	}
+
+	writeObject(ctx, tags, fasthttp.StatusOK)
+}
+
+func (h *HttpHandler) setProductTags(ctx *fasthttp.RequestCtx) {
+	productId, err := ctx.QueryArgs().GetUint("product_id")
+	if err != nil {
+		writeError(ctx, "failed to parse product id", fasthttp.StatusBadRequest)
+		return
+	}
+
+	var tagIds []uint
+	err = json.Unmarshal(ctx.PostBody(), &tagIds)
+	if err != nil {
+		writeError(ctx, "failed to parse tag ids", fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = h.tagsTable.SetProductTags(uint(productId), tagIds)
+	if err != nil {
+		logrus.Error("failed to set product tags: ", err.Error())
+		writeError(ctx, "failed to set product tags", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
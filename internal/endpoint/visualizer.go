@@ -0,0 +1,164 @@
+package endpoint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"paint-backend/internal/imaging"
+	"strconv"
+)
+
+const (
+	visualizerQuality    = 90
+	visualizerNameHeader = "X-Image-Name"
+
+	// the endpoint is public, so the photos are limited much harder than uploads
+	// and recolored at a working size to keep the memory of a request bounded
+	visualizerMaxPixels = 16_000_000
+	visualizerMaxSide   = 2048
+)
+
+func (h *HttpHandler) visualize(ctx *fasthttp.RequestCtx) {
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		writeError(ctx, "failed to parse multipart form: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	photo, err := readFormImage(form, "photo")
+	if err != nil {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	mask, err := readFormImage(form, "mask")
+	if err != nil {
+		writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	target, ok := h.visualizerTarget(ctx, form)
+	if !ok {
+		return
+	}
+
+	photo = imaging.Shrink(photo, visualizerMaxSide)
+	if bounds := photo.Bounds(); mask.Bounds().Size() != bounds.Size() {
+		mask = imaging.Resize(mask, bounds.Dx(), bounds.Dy())
+	}
+
+	var buffer bytes.Buffer
+	err = jpeg.Encode(&buffer, imaging.Recolor(photo, mask, target), &jpeg.Options{Quality: visualizerQuality})
+	if err != nil {
+		logrus.Error("failed to encode visualization: ", err.Error())
+		writeError(ctx, "failed to encode image", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	name, err := h.storage.InsertTemporaryImage("jpg", "image/jpeg", buffer.Bytes())
+	if err != nil {
+		logrus.Error("failed to insert visualization: ", err.Error())
+		writeError(ctx, "failed to insert image", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.Set(visualizerNameHeader, name)
+	ctx.Response.Header.Set("Access-Control-Expose-Headers", visualizerNameHeader)
+	ctx.Response.Header.Set(fasthttp.HeaderContentType, "image/jpeg")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	_, _ = ctx.Write(buffer.Bytes())
+}
+
+// visualizerTarget resolves the paint color either from the color value or from the product colors
+func (h *HttpHandler) visualizerTarget(ctx *fasthttp.RequestCtx, form *multipart.Form) (imaging.Color, bool) {
+	if hex := formValue(form, "color"); len(hex) != 0 {
+		target, err := imaging.ParseHex(hex)
+		if err != nil {
+			writeError(ctx, err.Error(), fasthttp.StatusBadRequest)
+			return imaging.Color{}, false
+		}
+
+		return target, true
+	}
+
+	productId, err := strconv.ParseUint(formValue(form, "product"), 10, 32)
+	if err != nil {
+		writeError(ctx, "either color or product must be passed", fasthttp.StatusBadRequest)
+		return imaging.Color{}, false
+	}
+
+	product, err := h.productsTable.GetById(uint(productId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(ctx, "product not found", fasthttp.StatusNotFound)
+		return imaging.Color{}, false
+	}
+	if err != nil {
+		logrus.Error("failed to get product: ", err.Error())
+		writeError(ctx, "failed to get product", fasthttp.StatusInternalServerError)
+		return imaging.Color{}, false
+	}
+
+	if len(product.Colors) == 0 {
+		writeError(ctx, "product has no colors", fasthttp.StatusBadRequest)
+		return imaging.Color{}, false
+	}
+
+	target, err := imaging.ParseHex(product.Colors[0])
+	if err != nil {
+		logrus.Errorf("product %d has invalid color: %s", product.Id, err.Error())
+		writeError(ctx, "product has invalid color", fasthttp.StatusInternalServerError)
+		return imaging.Color{}, false
+	}
+
+	return target, true
+}
+
+func readFormImage(form *multipart.Form, key string) (image.Image, error) {
+	files := form.File[key]
+	if len(files) == 0 {
+		return nil, fmt.Errorf("empty %s", key)
+	}
+
+	if files[0].Size > maxImageSizeInBytes {
+		return nil, fmt.Errorf("Too big %s", key)
+	}
+
+	file, err := files[0].Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !imaging.SupportedMime(mimeType) {
+		return nil, fmt.Errorf("Invalid %s type: %s. Allowed only jpeg, png, gif and webp", key, mimeType)
+	}
+
+	img, _, err := imaging.DecodeLimited(data, visualizerMaxPixels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+
+	return img, nil
+}
+
+func formValue(form *multipart.Form, key string) string {
+	if values := form.Value[key]; len(values) != 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,116 @@
+package imaging
+
+import (
+	"fmt"
+	"math"
+)
+
+type Color struct {
+	R, G, B uint8
+}
+
+// Lab is a color in CIE L*a*b* space with D65 white point
+type Lab struct {
+	L, A, B float64
+}
+
+func ParseHex(hex string) (Color, error) {
+	var c Color
+	_, err := fmt.Sscanf(hex, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid color %q: %w", hex, err)
+	}
+
+	return c, nil
+}
+
+func (c Color) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (c Color) Lab() Lab {
+	return rgbToLab(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// Distance returns CIE76 color difference
+func (l Lab) Distance(other Lab) float64 {
+	dl := l.L - other.L
+	da := l.A - other.A
+	db := l.B - other.B
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+func (l Lab) Color() Color {
+	r, g, b := labToRgb(l)
+	return Color{toByte(r), toByte(g), toByte(b)}
+}
+
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+func rgbToLab(r, g, b float64) Lab {
+	r, g, b = toLinear(r), toLinear(g), toLinear(b)
+
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+
+	return Lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+func labToRgb(l Lab) (float64, float64, float64) {
+	fy := (l.L + 16) / 116
+	fx := fy + l.A/500
+	fz := fy - l.B/200
+
+	x := labFInv(fx) * whiteX
+	y := labFInv(fy) * whiteY
+	z := labFInv(fz) * whiteZ
+
+	r := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b := 0.0556434*x - 0.2040259*y + 1.0572252*z
+
+	return toGamma(r), toGamma(g), toGamma(b)
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t3 := t * t * t; t3 > 216.0/24389 {
+		return t3
+	}
+	return (116*t - 16) * 27 / 24389
+}
+
+func toLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func toGamma(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func toByte(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
@@ -0,0 +1,85 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// maxPixels protects from images that are small in bytes but huge when decoded
+const maxPixels = 50_000_000
+
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+var supportedMimes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// SupportedMime reports whether images of the type can be uploaded
+func SupportedMime(mime string) bool {
+	return supportedMimes[mime]
+}
+
+// Decode fully decodes the image, checking its dimensions before allocating the pixels
+func Decode(data []byte) (image.Image, string, error) {
+	return DecodeLimited(data, maxPixels)
+}
+
+// DecodeLimited is Decode with a custom limit of pixels
+func DecodeLimited(data []byte, limit int) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, "", fmt.Errorf("invalid image size %dx%d", config.Width, config.Height)
+	}
+
+	if config.Width*config.Height > limit {
+		return nil, "", ErrTooManyPixels
+	}
+
+	return image.Decode(bytes.NewReader(data))
+}
+
+// Rule limits the dimensions of the images uploaded to a folder. Zero values are not checked.
+type Rule struct {
+	MinWidth  int     `mapstructure:"minWidth"`
+	MinHeight int     `mapstructure:"minHeight"`
+	MaxWidth  int     `mapstructure:"maxWidth"`
+	MaxHeight int     `mapstructure:"maxHeight"`
+	MinAspect float64 `mapstructure:"minAspect"`
+	MaxAspect float64 `mapstructure:"maxAspect"`
+}
+
+// Check returns the description of the first violated limit
+func (r Rule) Check(bounds image.Rectangle) error {
+	width, height := bounds.Dx(), bounds.Dy()
+	aspect := float64(width) / float64(height)
+
+	switch {
+	case width < r.MinWidth:
+		return fmt.Errorf("image width %d is less than %d", width, r.MinWidth)
+	case height < r.MinHeight:
+		return fmt.Errorf("image height %d is less than %d", height, r.MinHeight)
+	case r.MaxWidth > 0 && width > r.MaxWidth:
+		return fmt.Errorf("image width %d is greater than %d", width, r.MaxWidth)
+	case r.MaxHeight > 0 && height > r.MaxHeight:
+		return fmt.Errorf("image height %d is greater than %d", height, r.MaxHeight)
+	case r.MinAspect > 0 && aspect < r.MinAspect:
+		return fmt.Errorf("image aspect ratio %.2f is less than %.2f", aspect, r.MinAspect)
+	case r.MaxAspect > 0 && aspect > r.MaxAspect:
+		return fmt.Errorf("image aspect ratio %.2f is greater than %.2f", aspect, r.MaxAspect)
+	}
+
+	return nil
+}
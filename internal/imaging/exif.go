@@ -0,0 +1,351 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+)
+
+const (
+	orientationTag     = 0x0112
+	defaultOrientation = 1
+
+	// originalQuality is used when uploads have to be encoded again to apply the orientation
+	originalQuality = 95
+)
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader    = []byte("Exif\x00\x00")
+
+	errMalformed = errors.New("malformed image container")
+)
+
+// Sanitize removes the metadata (EXIF, XMP, IPTC, comments) of the encoded image and
+// returns it with the format it is encoded in. Images with a non-default EXIF
+// orientation are rotated and encoded again, webp ones as png since there is no
+// webp encoder.
+func Sanitize(data []byte) ([]byte, string, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	orientation := Orientation(data)
+	if orientation == defaultOrientation || format == "gif" {
+		data, err = StripMetadata(data, format)
+		return data, format, err
+	}
+
+	img, _, err := Decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	format = EncodingFormat(format)
+	data, err = encode(Orient(img, orientation), format, originalQuality)
+	return data, format, err
+}
+
+// Orientation returns the EXIF orientation of a jpeg, png or webp image, 1 if there is none
+func Orientation(data []byte) int {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(data, jpegSignature):
+		_ = walkJpegSegments(data, func(marker byte, segment []byte) bool {
+			if marker == 0xE1 && bytes.HasPrefix(segment[4:], exifHeader) {
+				tiff = segment[4+len(exifHeader):]
+				return false
+			}
+
+			return true
+		})
+	case bytes.HasPrefix(data, pngSignature):
+		_ = walkPngChunks(data, func(kind string, chunk []byte) bool {
+			if kind == "eXIf" {
+				tiff = chunk[8 : len(chunk)-4]
+				return false
+			}
+
+			return true
+		})
+	case isWebp(data):
+		_ = walkWebpChunks(data, func(kind string, chunk []byte) bool {
+			if kind == "EXIF" {
+				tiff = bytes.TrimPrefix(chunk[8:], exifHeader)
+				return false
+			}
+
+			return true
+		})
+	}
+
+	return tiffOrientation(tiff)
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of the EXIF data
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return defaultOrientation
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return defaultOrientation
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return defaultOrientation
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		if order.Uint16(tiff[entry:]) != orientationTag {
+			continue
+		}
+
+		value := int(order.Uint16(tiff[entry+8:]))
+		if value < 1 || value > 8 {
+			return defaultOrientation
+		}
+
+		return value
+	}
+
+	return defaultOrientation
+}
+
+// Orient transforms the pixels, so the image looks the way the orientation describes
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= defaultOrientation || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+
+	return dst
+}
+
+// StripMetadata removes the metadata without touching the compressed pixels.
+// Color profiles are kept since they affect how the image looks.
+func StripMetadata(data []byte, format string) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return stripJpeg(data)
+	case "png":
+		return stripPng(data)
+	case "webp":
+		return stripWebp(data)
+	}
+
+	return data, nil
+}
+
+func stripJpeg(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(jpegSignature)
+
+	end := len(jpegSignature)
+	err := walkJpegSegments(data, func(marker byte, segment []byte) bool {
+		end += len(segment)
+
+		// APP1 holds EXIF and XMP, APP13 holds IPTC
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(segment)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out.Write(data[end:])
+	return out.Bytes(), nil
+}
+
+// walkJpegSegments calls fn with every marker segment before the image data
+// until it returns false
+func walkJpegSegments(data []byte, fn func(marker byte, segment []byte) bool) error {
+	pos := len(jpegSignature)
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return errMalformed
+		}
+
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// fill byte before the marker
+			pos++
+			continue
+		}
+
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return errMalformed
+		}
+
+		if !fn(marker, data[pos:pos+2+length]) {
+			return nil
+		}
+
+		pos += 2 + length
+	}
+
+	return errMalformed
+}
+
+func stripPng(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	err := walkPngChunks(data, func(kind string, chunk []byte) bool {
+		switch kind {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(chunk)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// walkPngChunks calls fn with every chunk including its length, type and crc
+func walkPngChunks(data []byte, fn func(kind string, chunk []byte) bool) error {
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return errMalformed
+		}
+
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return errMalformed
+		}
+
+		if !fn(string(data[pos+4:pos+8]), data[pos:pos+12+length]) {
+			return nil
+		}
+
+		pos += 12 + length
+	}
+
+	return nil
+}
+
+func isWebp(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+func stripWebp(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	err := walkWebpChunks(data, func(kind string, chunk []byte) bool {
+		switch kind {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			// drop the flags announcing the removed chunks
+			extended := append([]byte(nil), chunk...)
+			extended[8] &^= 0x08 | 0x04
+			out.Write(extended)
+		default:
+			out.Write(chunk)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := out.Bytes()
+	binary.LittleEndian.PutUint32(res[4:], uint32(len(res)-8))
+	return res, nil
+}
+
+// walkWebpChunks calls fn with every RIFF chunk including its header and padding
+func walkWebpChunks(data []byte, fn func(kind string, chunk []byte) bool) error {
+	if !isWebp(data) {
+		return errMalformed
+	}
+
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return errMalformed
+		}
+
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			// the padding of the last chunk is sometimes missing
+			if pos+8+size != len(data) {
+				return errMalformed
+			}
+
+			end = len(data)
+		}
+
+		if !fn(string(data[pos:pos+4]), data[pos:end]) {
+			return nil
+		}
+
+		pos = end
+	}
+
+	return nil
+}
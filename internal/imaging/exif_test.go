@@ -0,0 +1,222 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifTiff builds EXIF data holding only the orientation tag
+func exifTiff(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], orientationTag)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	return tiff
+}
+
+// exifSegment prefixes the EXIF data with the header of the jpeg APP1 segment
+func exifSegment(tiff []byte) []byte {
+	return append(append([]byte{}, exifHeader...), tiff...)
+}
+
+// withJpegSegment inserts the segment right after the start of image marker
+func withJpegSegment(data []byte, marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	res := append([]byte{}, data[:2]...)
+	res = append(res, segment...)
+	return append(res, data[2:]...)
+}
+
+// withPngChunk inserts the chunk right after IHDR
+func withPngChunk(data []byte, kind string, payload []byte) []byte {
+	chunk := make([]byte, 4, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	ihdrEnd := len(pngSignature) + 12 + 13
+	res := append([]byte{}, data[:ihdrEnd]...)
+	res = append(res, chunk...)
+	return append(res, data[ihdrEnd:]...)
+}
+
+func testImage(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 40), G: uint8(y * 40), B: 0x80, A: 0xff})
+		}
+	}
+
+	return img
+}
+
+func encodeJpeg(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func encodePng(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestOrientation(t *testing.T) {
+	plainJpeg := encodeJpeg(t, testImage(4, 2))
+	plainPng := encodePng(t, testImage(4, 2))
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{name: "jpeg without exif", data: plainJpeg, want: 1},
+		{name: "jpeg little endian", data: withJpegSegment(plainJpeg, 0xE1, exifSegment(exifTiff(binary.LittleEndian, 6))), want: 6},
+		{name: "jpeg big endian", data: withJpegSegment(plainJpeg, 0xE1, exifSegment(exifTiff(binary.BigEndian, 3))), want: 3},
+		{name: "jpeg invalid value", data: withJpegSegment(plainJpeg, 0xE1, exifSegment(exifTiff(binary.BigEndian, 9))), want: 1},
+		{name: "jpeg truncated exif", data: withJpegSegment(plainJpeg, 0xE1, exifSegment([]byte("II*"))), want: 1},
+		{name: "png without exif", data: plainPng, want: 1},
+		{name: "png exif", data: withPngChunk(plainPng, "eXIf", exifTiff(binary.BigEndian, 8)), want: 8},
+		{name: "not an image", data: []byte("hello"), want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := Orientation(tt.data); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	plainJpeg := encodeJpeg(t, testImage(4, 2))
+	plainPng := encodePng(t, testImage(4, 2))
+
+	jpegWithMeta := withJpegSegment(plainJpeg, 0xE1, exifSegment(exifTiff(binary.LittleEndian, 1)))
+	jpegWithMeta = withJpegSegment(jpegWithMeta, 0xFE, []byte("secret comment"))
+	jpegWithMeta = withJpegSegment(jpegWithMeta, 0xED, []byte("Photoshop 3.0\x00secret iptc"))
+
+	pngWithMeta := withPngChunk(plainPng, "eXIf", exifTiff(binary.BigEndian, 1))
+	pngWithMeta = withPngChunk(pngWithMeta, "tEXt", []byte("Author\x00secret"))
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		want   []byte
+	}{
+		{name: "jpeg", data: jpegWithMeta, format: "jpeg", want: plainJpeg},
+		{name: "plain jpeg", data: plainJpeg, format: "jpeg", want: plainJpeg},
+		{name: "png", data: pngWithMeta, format: "png", want: plainPng},
+		{name: "plain png", data: plainPng, format: "png", want: plainPng},
+	}
+
+	for _, tt := range tests {
+		got, err := StripMetadata(tt.data, tt.format)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if bytes.Contains(got, []byte("secret")) || bytes.Contains(got, exifHeader) {
+			t.Errorf("%s: metadata left in the image", tt.name)
+		}
+
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: stripped image differs from the one without metadata", tt.name)
+		}
+	}
+
+	_, err := StripMetadata(plainJpeg[:len(plainJpeg)/2], "jpeg")
+	if err == nil {
+		t.Error("truncated jpeg stripped without an error")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	src := testImage(3, 2)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		// where the top left source pixel ends up
+		topLeft image.Point
+	}{
+		{orientation: 1, size: image.Pt(3, 2), topLeft: image.Pt(0, 0)},
+		{orientation: 2, size: image.Pt(3, 2), topLeft: image.Pt(2, 0)},
+		{orientation: 3, size: image.Pt(3, 2), topLeft: image.Pt(2, 1)},
+		{orientation: 4, size: image.Pt(3, 2), topLeft: image.Pt(0, 1)},
+		{orientation: 5, size: image.Pt(2, 3), topLeft: image.Pt(0, 0)},
+		{orientation: 6, size: image.Pt(2, 3), topLeft: image.Pt(1, 0)},
+		{orientation: 7, size: image.Pt(2, 3), topLeft: image.Pt(1, 2)},
+		{orientation: 8, size: image.Pt(2, 3), topLeft: image.Pt(0, 2)},
+	}
+
+	for _, tt := range tests {
+		dst := Orient(src, tt.orientation)
+		if dst.Bounds().Size() != tt.size {
+			t.Errorf("orientation %d: size %v, want %v", tt.orientation, dst.Bounds().Size(), tt.size)
+			continue
+		}
+
+		if dst.At(tt.topLeft.X, tt.topLeft.Y) != src.At(0, 0) {
+			t.Errorf("orientation %d: top left pixel is not at %v", tt.orientation, tt.topLeft)
+		}
+	}
+}
+
+func TestSanitizeRotates(t *testing.T) {
+	data := withJpegSegment(encodeJpeg(t, testImage(4, 2)), 0xE1, exifSegment(exifTiff(binary.LittleEndian, 6)))
+
+	sanitized, format, err := Sanitize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != "jpeg" {
+		t.Fatalf("format %s, want jpeg", format)
+	}
+
+	if Orientation(sanitized) != defaultOrientation {
+		t.Fatal("orientation left in the sanitized image")
+	}
+
+	config, err := jpeg.DecodeConfig(bytes.NewReader(sanitized))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Width != 2 || config.Height != 4 {
+		t.Fatalf("sanitized size %dx%d, want 2x4", config.Width, config.Height)
+	}
+}
@@ -0,0 +1,169 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	paletteSampleSide    = 64
+	paletteIterations    = 20
+	paletteMinAlpha      = 0x8000
+	paletteMergeDistance = 5
+)
+
+// DominantColors clusters downsampled pixels of the image with k-means in Lab
+// space and returns up to k cluster centers, the most populated first
+func DominantColors(img image.Image, k int) []Color {
+	samples := samplePixels(img)
+	if len(samples) == 0 || k <= 0 {
+		return nil
+	}
+
+	if k > len(samples) {
+		k = len(samples)
+	}
+
+	centers := initCenters(samples, k)
+	assignments := make([]int, len(samples))
+	for iteration := 0; iteration < paletteIterations; iteration++ {
+		changed := false
+		for i, sample := range samples {
+			nearest := nearestCenter(centers, sample)
+			if nearest != assignments[i] || iteration == 0 {
+				assignments[i] = nearest
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+
+		sums := make([]Lab, len(centers))
+		counts := make([]int, len(centers))
+		for i, sample := range samples {
+			c := assignments[i]
+			sums[c].L += sample.L
+			sums[c].A += sample.A
+			sums[c].B += sample.B
+			counts[c]++
+		}
+
+		for c := range centers {
+			if counts[c] != 0 {
+				n := float64(counts[c])
+				centers[c] = Lab{sums[c].L / n, sums[c].A / n, sums[c].B / n}
+			}
+		}
+	}
+
+	counts := make([]int, len(centers))
+	for _, c := range assignments {
+		counts[c]++
+	}
+
+	order := make([]int, len(centers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+
+	var res []Color
+	var picked []Lab
+	for _, c := range order {
+		if counts[c] == 0 || isNear(picked, centers[c]) {
+			continue
+		}
+
+		picked = append(picked, centers[c])
+		res = append(res, centers[c].Color())
+	}
+
+	return res
+}
+
+func samplePixels(img image.Image) []Lab {
+	bounds := img.Bounds()
+	stepX := int(math.Max(1, math.Ceil(float64(bounds.Dx())/paletteSampleSide)))
+	stepY := int(math.Max(1, math.Ceil(float64(bounds.Dy())/paletteSampleSide)))
+
+	samples := make([]Lab, 0, paletteSampleSide*paletteSampleSide)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < paletteMinAlpha {
+				continue
+			}
+
+			// colors are alpha-premultiplied
+			samples = append(samples, rgbToLab(float64(r)/float64(a), float64(g)/float64(a), float64(b)/float64(a)))
+		}
+	}
+
+	return samples
+}
+
+// initCenters picks initial centers with k-means++ using a fixed seed, so
+// the same image always produces the same palette
+func initCenters(samples []Lab, k int) []Lab {
+	random := rand.New(rand.NewSource(1))
+
+	centers := make([]Lab, 0, k)
+	centers = append(centers, samples[random.Intn(len(samples))])
+
+	distances := make([]float64, len(samples))
+	for len(centers) < k {
+		var total float64
+		for i, sample := range samples {
+			d := sample.Distance(centers[nearestCenter(centers, sample)])
+			distances[i] = d * d
+			total += distances[i]
+		}
+
+		if total == 0 {
+			break
+		}
+
+		target := random.Float64() * total
+		chosen := len(samples) - 1
+		for i, d := range distances {
+			target -= d
+			if target <= 0 {
+				chosen = i
+				break
+			}
+		}
+
+		centers = append(centers, samples[chosen])
+	}
+
+	return centers
+}
+
+func nearestCenter(centers []Lab, sample Lab) int {
+	nearest := 0
+	best := math.MaxFloat64
+	for i, center := range centers {
+		if d := sample.Distance(center); d < best {
+			best = d
+			nearest = i
+		}
+	}
+
+	return nearest
+}
+
+func isNear(colors []Lab, color Lab) bool {
+	for _, c := range colors {
+		if c.Distance(color) < paletteMergeDistance {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+const maskThreshold = 0.5
+
+// Recolor paints the area of the photo marked by the mask with the target color.
+// The hue and chroma of the masked pixels are shifted in Lab space towards the
+// target while their lightness is kept, so shading and texture stay visible.
+// White mask pixels are fully recolored, black ones are left untouched and the
+// mask is stretched if its size differs from the photo.
+func Recolor(photo image.Image, mask image.Image, target Color) *image.RGBA {
+	bounds := photo.Bounds()
+	res := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	weights := make([]float64, bounds.Dx()*bounds.Dy())
+	pixels := make([]Lab, len(weights))
+
+	var sumA, sumB, sumWeight float64
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			i := y*bounds.Dx() + x
+
+			r, g, b, _ := photo.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			pixels[i] = rgbToLab(float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+			weights[i] = maskWeight(mask, bounds, x, y)
+
+			if weights[i] >= maskThreshold {
+				sumA += pixels[i].A * weights[i]
+				sumB += pixels[i].B * weights[i]
+				sumWeight += weights[i]
+			}
+		}
+	}
+
+	targetLab := target.Lab()
+	var shiftA, shiftB float64
+	if sumWeight != 0 {
+		shiftA = targetLab.A - sumA/sumWeight
+		shiftB = targetLab.B - sumB/sumWeight
+	}
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			i := y*bounds.Dx() + x
+			w := weights[i]
+			if w == 0 {
+				res.Set(x, y, photo.At(bounds.Min.X+x, bounds.Min.Y+y))
+				continue
+			}
+
+			pixel := pixels[i]
+			pixel.A += shiftA * w
+			pixel.B += shiftB * w
+
+			c := pixel.Color()
+			res.SetRGBA(x, y, color.RGBA{R: c.R, G: c.G, B: c.B, A: 0xff})
+		}
+	}
+
+	return res
+}
+
+func maskWeight(mask image.Image, photoBounds image.Rectangle, x int, y int) float64 {
+	maskBounds := mask.Bounds()
+	mx := maskBounds.Min.X + x*maskBounds.Dx()/photoBounds.Dx()
+	my := maskBounds.Min.Y + y*maskBounds.Dy()/photoBounds.Dy()
+
+	gray := color.Gray16Model.Convert(mask.At(mx, my)).(color.Gray16)
+	return float64(gray.Y) / 0xffff
+}
@@ -0,0 +1,205 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+)
+
+const encodeQuality = 85
+
+// ResizeToWidth scales the image to the width keeping its aspect ratio
+func ResizeToWidth(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	height := int(math.Round(float64(bounds.Dy()) * float64(width) / float64(bounds.Dx())))
+	if height < 1 {
+		height = 1
+	}
+
+	return Resize(img, width, height)
+}
+
+// Shrink scales the image down so its longer side is at most maxSide,
+// smaller images are returned as is
+func Shrink(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= maxSide && bounds.Dy() <= maxSide {
+		return img
+	}
+
+	return Fit(img, maxSide, maxSide, FitContain)
+}
+
+type FitMode string
+
+const (
+	// FitCover fills the whole box cropping what doesn't fit around the center
+	FitCover FitMode = "cover"
+	// FitContain scales the image to fit inside the box keeping all of it
+	FitContain FitMode = "contain"
+)
+
+func (m FitMode) Valid() bool {
+	return m == FitCover || m == FitContain
+}
+
+// Fit scales the image into the width x height box according to the mode
+func Fit(img image.Image, width int, height int, mode FitMode) *image.RGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := float64(bounds.Dx()), float64(bounds.Dy())
+
+	if mode == FitContain {
+		scale := math.Min(float64(width)/srcWidth, float64(height)/srcHeight)
+		return Resize(img, max(1, int(math.Round(srcWidth*scale))), max(1, int(math.Round(srcHeight*scale))))
+	}
+
+	// crop the source to the aspect ratio of the box before scaling
+	crop := bounds
+	if srcWidth*float64(height) > srcHeight*float64(width) {
+		cropWidth := int(math.Round(srcHeight * float64(width) / float64(height)))
+		crop.Min.X += (bounds.Dx() - cropWidth) / 2
+		crop.Max.X = crop.Min.X + max(1, cropWidth)
+	} else {
+		cropHeight := int(math.Round(srcWidth * float64(height) / float64(width)))
+		crop.Min.Y += (bounds.Dy() - cropHeight) / 2
+		crop.Max.Y = crop.Min.Y + max(1, cropHeight)
+	}
+
+	rgba := toRGBA(img)
+	return Resize(rgba.SubImage(crop.Sub(bounds.Min)), width, height)
+}
+
+// Resize scales the image to exactly width x height. Every destination pixel is
+// the area weighted average of the source pixels it covers, which gives smooth
+// results when downscaling.
+func Resize(img image.Image, width int, height int) *image.RGBA {
+	src := toRGBA(img)
+	srcWidth, srcHeight := src.Rect.Dx(), src.Rect.Dy()
+
+	columns := resizeWeights(srcWidth, width)
+	rows := resizeWeights(srcHeight, height)
+
+	// horizontal pass into a srcHeight x width buffer of premultiplied channels
+	buffer := make([]float64, srcHeight*width*4)
+	for y := 0; y < srcHeight; y++ {
+		line := src.Pix[y*src.Stride:]
+		for x, weights := range columns {
+			var r, g, b, a float64
+			for _, w := range weights {
+				i := w.index * 4
+				r += float64(line[i]) * w.weight
+				g += float64(line[i+1]) * w.weight
+				b += float64(line[i+2]) * w.weight
+				a += float64(line[i+3]) * w.weight
+			}
+
+			j := (y*width + x) * 4
+			buffer[j], buffer[j+1], buffer[j+2], buffer[j+3] = r, g, b, a
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range rows {
+		for x := 0; x < width; x++ {
+			var r, g, b, a float64
+			for _, w := range weights {
+				j := (w.index*width + x) * 4
+				r += buffer[j] * w.weight
+				g += buffer[j+1] * w.weight
+				b += buffer[j+2] * w.weight
+				a += buffer[j+3] * w.weight
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = clampByte(r), clampByte(g), clampByte(b), clampByte(a)
+		}
+	}
+
+	return dst
+}
+
+type resizeWeight struct {
+	index  int
+	weight float64
+}
+
+// resizeWeights returns for every destination pixel the source pixels it covers
+// and the share of each of them. Upscaling falls back to the nearest neighbour.
+func resizeWeights(srcSize int, dstSize int) [][]resizeWeight {
+	scale := float64(srcSize) / float64(dstSize)
+
+	res := make([][]resizeWeight, dstSize)
+	for i := range res {
+		if scale <= 1 {
+			res[i] = []resizeWeight{{index: int(float64(i) * scale), weight: 1}}
+			continue
+		}
+
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			covered := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if covered > 0 {
+				res[i] = append(res[i], resizeWeight{index: j, weight: covered / scale})
+			}
+		}
+	}
+
+	return res
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
+
+// EncodingFormat returns the format images decoded from the format are encoded to,
+// webp has no encoder in the standard library and falls back to png
+func EncodingFormat(format string) string {
+	if format == "webp" {
+		return "png"
+	}
+
+	return format
+}
+
+// Encode writes the image in the format Decode reported for it
+func Encode(img image.Image, format string) ([]byte, error) {
+	return encode(img, format, encodeQuality)
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(&buffer, img)
+	case "gif":
+		err = gif.Encode(&buffer, img, nil)
+	default:
+		return nil, fmt.Errorf("unsupported image format %s", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
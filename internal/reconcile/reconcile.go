@@ -0,0 +1,155 @@
+package reconcile
+
+import (
+	"github.com/spf13/viper"
+	"paint-backend/internal/repo"
+	"paint-backend/internal/s3"
+	"sort"
+	"time"
+)
+
+// Options controls what Run does besides reporting
+type Options struct {
+	// Quarantine moves orphaned objects to the quarantine prefix
+	Quarantine bool
+	// Purge deletes objects that stayed in quarantine longer than Grace
+	Purge bool
+	// MinAge protects fresh uploads that are not referenced yet
+	MinAge time.Duration
+	Grace  time.Duration
+}
+
+// LoadOptions reads the age limits from the images.reconcile configuration section
+func LoadOptions() Options {
+	return Options{
+		MinAge: viper.GetDuration("images.reconcile.minAge"),
+		Grace:  viper.GetDuration("images.reconcile.grace"),
+	}
+}
+
+// Orphan is an object of the bucket that no row references
+type Orphan struct {
+	Name         string    `json:"name"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Dangling is a reference to an object that is not in the bucket
+type Dangling struct {
+	repo.ImageReference
+	InQuarantine bool `json:"inQuarantine"`
+}
+
+type Report struct {
+	Objects     int        `json:"objects"`
+	References  int        `json:"references"`
+	Orphaned    []Orphan   `json:"orphaned"`
+	Dangling    []Dangling `json:"dangling"`
+	Quarantined []string   `json:"quarantined"`
+	Purged      []string   `json:"purged"`
+}
+
+type Reconciler struct {
+	storage         *s3.Storage
+	referencesTable *repo.ImageReferencesTable
+	palettesTable   *repo.ImagePalettesTable
+	imageHashes     *repo.ImageHashesTable
+}
+
+func NewReconciler(storage *s3.Storage, referencesTable *repo.ImageReferencesTable, palettesTable *repo.ImagePalettesTable, imageHashes *repo.ImageHashesTable) *Reconciler {
+	return &Reconciler{storage, referencesTable, palettesTable, imageHashes}
+}
+
+// Run compares the bucket against the image references of the database
+func (r *Reconciler) Run(options Options) (Report, error) {
+	report := Report{Orphaned: []Orphan{}, Dangling: []Dangling{}, Quarantined: []string{}, Purged: []string{}}
+
+	// references are read after the listing, so an image uploaded and
+	// referenced in between is never taken for an orphan
+	objects, err := r.storage.GetImagesWithMeta()
+	if err != nil {
+		return Report{}, err
+	}
+
+	references, err := r.referencesTable.GetAll()
+	if err != nil {
+		return Report{}, err
+	}
+
+	quarantined, err := r.storage.GetQuarantined()
+	if err != nil {
+		return Report{}, err
+	}
+
+	report.Objects = len(objects)
+	report.References = len(references)
+
+	referenced := make(map[string]bool, len(references))
+	for _, ref := range references {
+		referenced[ref.Name] = true
+	}
+
+	existing := make(map[string]bool, len(objects))
+	deadline := time.Now().Add(-options.MinAge)
+	for _, object := range objects {
+		existing[object.Name] = true
+		if !referenced[object.Name] && object.LastModified.Before(deadline) {
+			report.Orphaned = append(report.Orphaned, Orphan{object.Name, object.LastModified})
+		}
+	}
+
+	inQuarantine := make(map[string]bool, len(quarantined))
+	for _, object := range quarantined {
+		inQuarantine[object.Name] = true
+	}
+
+	for _, ref := range references {
+		if !existing[ref.Name] {
+			report.Dangling = append(report.Dangling, Dangling{ref, inQuarantine[ref.Name]})
+		}
+	}
+
+	sort.Slice(report.Orphaned, func(i, j int) bool {
+		return report.Orphaned[i].Name < report.Orphaned[j].Name
+	})
+
+	if options.Quarantine {
+		names := make([]string, 0, len(report.Orphaned))
+		for _, orphan := range report.Orphaned {
+			names = append(names, orphan.Name)
+		}
+
+		moved, err := r.storage.QuarantineImages(names)
+		report.Quarantined = append(report.Quarantined, moved...)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if options.Purge {
+		// referenced images in quarantine wait for a restore instead of being purged
+		purged, err := r.storage.PurgeQuarantine(options.Grace, referenced)
+		report.Purged = append(report.Purged, purged...)
+		if err != nil {
+			return report, err
+		}
+
+		for _, name := range purged {
+			// the name was uploaded again, the rows belong to the new image
+			if existing[name] {
+				continue
+			}
+
+			err = r.palettesTable.Delete(name)
+			if err != nil {
+				return report, err
+			}
+
+			err = r.imageHashes.Delete(name)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, nil
+}
@@ -2,12 +2,36 @@ package repo
 
 import (
 	"context"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Brand struct {
-	Id   uint   `json:"id"`
-	Name string `json:"name"`
+	Id          uint   `json:"id"`
+	Name        string `json:"name"`
+	Logo        string `json:"logo"`
+	Country     string `json:"country"`
+	Description string `json:"description"`
+	Website     string `json:"website"`
+	Featured    bool   `json:"featured"`
+}
+
+type BrandSubject struct {
+	Id           uint   `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	ProductCount int    `json:"productCount"`
+}
+
+type BrandWithCount struct {
+	Brand
+	ProductCount int `json:"productCount"`
+}
+
+type BrandPage struct {
+	Brand
+	ProductCount int            `json:"productCount"`
+	Subjects     []BrandSubject `json:"subjects"`
 }
 
 type BrandsTable struct {
@@ -15,10 +39,33 @@ type BrandsTable struct {
 }
 
 const (
-	getAllBrandsQuery = `SELECT * FROM brands`
-	insertBrandQuery  = `INSERT INTO brands (name) values ($1)`
-	updateBrandQuery  = `UPDATE brands SET name = $2 WHERE id = $1`
+	brandColumns = `id, name, COALESCE(logo, ''), COALESCE(country, ''), COALESCE(description, ''), COALESCE(website, ''), featured`
+
+	getAllBrandsQuery = `SELECT ` + brandColumns + ` FROM brands ORDER BY featured DESC, name`
+	getBrandQuery     = `SELECT ` + brandColumns + ` FROM brands WHERE id = COALESCE((SELECT brand_id FROM brand_aliases WHERE alias_id = $1), $1)`
+	insertBrandQuery  = `INSERT INTO brands (name, logo, country, description, website, featured) values ($1, $2, $3, $4, $5, $6)`
+	updateBrandQuery  = `UPDATE brands SET name = $2, logo = $3, country = $4, description = $5, website = $6, featured = $7 WHERE id = COALESCE((SELECT brand_id FROM brand_aliases WHERE alias_id = $1), $1)`
 	deleteBrandQuery  = `DELETE FROM brands WHERE id = $1`
+
+	getBrandSubjectsQuery = `SELECT s.id, s.name, COALESCE(s.slug, ''), count(p.id) FROM products p
+							 JOIN subjects s ON s.id = p.subject_id
+							 WHERE p.brand_id = $1
+							 GROUP BY s.id
+							 ORDER BY s.position, s.id`
+
+	getBrandsBySubjectQuery = `WITH RECURSIVE subtree AS (
+								   SELECT id, 1 AS level FROM subjects WHERE id = $1
+								   UNION ALL
+								   SELECT s.id, st.level + 1 FROM subjects s
+								   JOIN subtree st ON s.parent_id = st.id
+								   WHERE $2::BOOLEAN AND st.level < 64
+							   )
+							   SELECT b.id, b.name, COALESCE(b.logo, ''), COALESCE(b.country, ''), COALESCE(b.description, ''), COALESCE(b.website, ''), b.featured, count(p.id)
+							   FROM products p
+							   JOIN brands b ON b.id = p.brand_id
+							   WHERE p.subject_id IN (SELECT id FROM subtree) AND ($3::BOOLEAN IS FALSE OR p.stock = $4)
+							   GROUP BY b.id
+							   ORDER BY b.featured DESC, b.name`
 )
 
 func NewBrandsTable(db *pgxpool.Pool) *BrandsTable {
@@ -35,7 +82,7 @@ func (t *BrandsTable) GetAll() ([]Brand, error) {
 	for rows.Next() {
 		var b Brand
 
-		err = rows.Scan(&b.Id, &b.Name)
+		b, err = scanBrand(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -48,17 +95,114 @@ func (t *BrandsTable) GetAll() ([]Brand, error) {
 	return res, rows.Err()
 }
 
-func (t *BrandsTable) Insert(s Brand) error {
-	_, err := t.db.Exec(context.Background(), insertBrandQuery, s.Name)
-	return err
+func (t *BrandsTable) GetById(id uint) (Brand, error) {
+	return scanBrand(t.db.QueryRow(context.Background(), getBrandQuery, id))
 }
 
-func (t *BrandsTable) Update(s Brand) error {
-	_, err := t.db.Exec(context.Background(), updateBrandQuery, s.Id, s.Name)
-	return err
+func scanBrand(row pgx.Row) (Brand, error) {
+	var b Brand
+	err := row.Scan(&b.Id, &b.Name, &b.Logo, &b.Country, &b.Description, &b.Website, &b.Featured)
+	return b, err
+}
+
+// GetBySubject returns brands having products in the subject, optionally including
+// its descendants and counting only products in stock
+func (t *BrandsTable) GetBySubject(subjectId uint, descendants bool, inStock bool) ([]BrandWithCount, error) {
+	rows, err := t.db.Query(context.Background(), getBrandsBySubjectQuery, subjectId, descendants, inStock, InStock)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []BrandWithCount
+	for rows.Next() {
+		var b BrandWithCount
+
+		err = rows.Scan(&b.Id, &b.Name, &b.Logo, &b.Country, &b.Description, &b.Website, &b.Featured, &b.ProductCount)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, b)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+// GetPage returns the brand profile with the subjects it has products in
+func (t *BrandsTable) GetPage(id uint) (BrandPage, error) {
+	brand, err := t.GetById(id)
+	if err != nil {
+		return BrandPage{}, err
+	}
+
+	page := BrandPage{Brand: brand, Subjects: []BrandSubject{}}
+
+	rows, err := t.db.Query(context.Background(), getBrandSubjectsQuery, brand.Id)
+	if err != nil {
+		return BrandPage{}, err
+	}
+
+	for rows.Next() {
+		var s BrandSubject
+
+		err = rows.Scan(&s.Id, &s.Name, &s.Slug, &s.ProductCount)
+		if err != nil {
+			return BrandPage{}, err
+		}
+
+		page.ProductCount += s.ProductCount
+		page.Subjects = append(page.Subjects, s)
+	}
+
+	rows.Close()
+
+	return page, rows.Err()
 }
 
-func (t *BrandsTable) Delete(id uint) error {
-	_, err := t.db.Exec(context.Background(), deleteBrandQuery, id)
+func (t *BrandsTable) Insert(b Brand) error {
+	_, err := t.db.Exec(context.Background(), insertBrandQuery, b.Name, b.Logo, b.Country, b.Description, b.Website, b.Featured)
 	return err
 }
+
+// Update changes the brand, the id of a merged brand updates the brand it was merged into
+func (t *BrandsTable) Update(b Brand) error {
+	tag, err := t.db.Exec(context.Background(), updateBrandQuery, b.Id, b.Name, b.Logo, b.Country, b.Description, b.Website, b.Featured)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// Delete deletes the brand cancelling the pending price batches targeting it
+// and returns ids of the cancelled batches
+func (t *BrandsTable) Delete(id uint) ([]uint, error) {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(context.Background())
+
+	batches, err := getPendingBatches(tx, getBrandsPendingBatchesQuery, []uint{id})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cancelBatches(tx, batches)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(context.Background(), deleteBrandQuery, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return batches, tx.Commit(context.Background())
+}
@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrMergeIntoItself = errors.New("brand can't be merged into itself")
+
+type BrandMergeRequest struct {
+	Target  uint   `json:"target"`
+	Sources []uint `json:"sources"`
+}
+
+type BrandMergeReport struct {
+	Target            uint   `json:"target"`
+	Sources           []uint `json:"sources"`
+	Products          int    `json:"products"`
+	BrandLinksMoved   int    `json:"brandLinksMoved"`
+	BrandLinksRemoved int    `json:"brandLinksRemoved"`
+	Aliases           int    `json:"aliases"`
+	PriceBatches      []uint `json:"priceBatches"`
+	DryRun            bool   `json:"dryRun"`
+}
+
+const (
+	lockBrandsQuery = `SELECT count(*) FROM (SELECT id FROM brands WHERE id = ANY($1::INTEGER[]) FOR UPDATE) locked`
+
+	countBrandsProductsQuery = `SELECT count(*) FROM products WHERE brand_id = ANY($1::INTEGER[])`
+	countBrandLinksQuery     = `SELECT count(*) FROM subjects_brands WHERE brand_id = ANY($1::INTEGER[])`
+	countMovedLinksQuery     = `SELECT count(DISTINCT subject_id) FROM subjects_brands sb
+								WHERE sb.brand_id = ANY($1::INTEGER[]) AND NOT EXISTS (
+									SELECT 1 FROM subjects_brands existing
+									WHERE existing.brand_id = $2 AND existing.subject_id IS NOT DISTINCT FROM sb.subject_id
+								)`
+	countBrandsAliasesQuery = `SELECT count(*) FROM brand_aliases WHERE brand_id = ANY($1::INTEGER[])`
+
+	mergeProductsQuery = `UPDATE products SET brand_id = $2 WHERE brand_id = ANY($1::INTEGER[])`
+	mergeAliasesQuery  = `UPDATE brand_aliases SET brand_id = $2 WHERE brand_id = ANY($1::INTEGER[])`
+	insertAliasesQuery = `INSERT INTO brand_aliases (alias_id, brand_id) SELECT UNNEST($1::INTEGER[]), $2
+						  ON CONFLICT (alias_id) DO UPDATE SET brand_id = excluded.brand_id`
+	mergePriceBatchesQuery = `UPDATE price_batches SET rule_brand_id = $2 WHERE rule_brand_id = ANY($1::INTEGER[])`
+	deleteBrandsQuery      = `DELETE FROM brands WHERE id = ANY($1::INTEGER[])`
+
+	resolveBrandIdQuery = `SELECT COALESCE((SELECT brand_id FROM brand_aliases WHERE alias_id = $1), $1)`
+)
+
+// Merge moves products, subject links, aliases and price batch rules of the source
+// brands to the target brand and deletes the sources keeping their ids as aliases of the target.
+// With dryRun the report is built without changing anything.
+func (t *BrandsTable) Merge(request BrandMergeRequest, dryRun bool) (BrandMergeReport, error) {
+	sources := uniqueIds(request.Sources)
+	for _, id := range sources {
+		if id == request.Target {
+			return BrandMergeReport{}, ErrMergeIntoItself
+		}
+	}
+
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return BrandMergeReport{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var locked int
+	err = tx.QueryRow(context.Background(), lockBrandsQuery, append([]uint{request.Target}, sources...)).Scan(&locked)
+	if err != nil {
+		return BrandMergeReport{}, err
+	}
+
+	if locked != len(sources)+1 {
+		return BrandMergeReport{}, pgx.ErrNoRows
+	}
+
+	report := BrandMergeReport{Target: request.Target, Sources: sources, DryRun: dryRun}
+
+	var links int
+	counts := []struct {
+		query string
+		args  []any
+		dest  *int
+	}{
+		{countBrandsProductsQuery, []any{sources}, &report.Products},
+		{countBrandLinksQuery, []any{sources}, &links},
+		{countMovedLinksQuery, []any{sources, request.Target}, &report.BrandLinksMoved},
+		{countBrandsAliasesQuery, []any{sources}, &report.Aliases},
+	}
+
+	for _, count := range counts {
+		err = tx.QueryRow(context.Background(), count.query, count.args...).Scan(count.dest)
+		if err != nil {
+			return BrandMergeReport{}, err
+		}
+	}
+
+	report.PriceBatches, err = getPendingBatches(tx, getBrandsPendingBatchesQuery, sources)
+	if err != nil {
+		return BrandMergeReport{}, err
+	}
+
+	report.BrandLinksRemoved = links - report.BrandLinksMoved
+	report.Aliases += len(sources)
+
+	if dryRun {
+		return report, nil
+	}
+
+	// subject links follow the products by the products trigger
+	for _, query := range []string{mergeProductsQuery, mergeAliasesQuery, insertAliasesQuery, mergePriceBatchesQuery} {
+		_, err = tx.Exec(context.Background(), query, sources, request.Target)
+		if err != nil {
+			return BrandMergeReport{}, err
+		}
+	}
+
+	_, err = tx.Exec(context.Background(), deleteBrandsQuery, sources)
+	if err != nil {
+		return BrandMergeReport{}, err
+	}
+
+	return report, tx.Commit(context.Background())
+}
+
+// ResolveId returns the id of the brand the passed id was merged into or the id itself
+func (t *BrandsTable) ResolveId(id uint) (uint, error) {
+	err := t.db.QueryRow(context.Background(), resolveBrandIdQuery, id).Scan(&id)
+	return id, err
+}
+
+func uniqueIds(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	res := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,230 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+var ErrUnknownCollectionProduct = errors.New("collection colors reference unknown products")
+
+type CollectionColor struct {
+	Name      string `json:"name"`
+	Hex       string `json:"hex"`
+	ProductId uint   `json:"product"`
+}
+
+type Collection struct {
+	Id          uint              `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	CoverImage  string            `json:"coverImage"`
+	PublishFrom *time.Time        `json:"publishFrom"`
+	PublishTo   *time.Time        `json:"publishTo"`
+	Colors      []CollectionColor `json:"colors"`
+}
+
+type CollectionsTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	publishedCollectionCondition = `publish_from IS NOT NULL AND publish_from <= now() AND (publish_to IS NULL OR publish_to > now())`
+
+	getAllCollectionsQuery       = `SELECT id, name, COALESCE(description, ''), COALESCE(cover_image, ''), publish_from, publish_to FROM color_collections ORDER BY publish_from DESC NULLS LAST, id`
+	getPublishedCollectionsQuery = `SELECT id, name, COALESCE(description, ''), COALESCE(cover_image, ''), publish_from, publish_to FROM color_collections WHERE ` + publishedCollectionCondition + ` ORDER BY publish_from DESC, id`
+	getCollectionQuery           = `SELECT id, name, COALESCE(description, ''), COALESCE(cover_image, ''), publish_from, publish_to FROM color_collections WHERE id = $1`
+	getPublishedCollectionQuery  = getCollectionQuery + ` AND ` + publishedCollectionCondition
+	insertCollectionQuery        = `INSERT INTO color_collections (name, description, cover_image, publish_from, publish_to) values ($1, $2, $3, $4, $5) RETURNING id`
+	updateCollectionQuery        = `UPDATE color_collections SET name = $2, description = $3, cover_image = $4, publish_from = $5, publish_to = $6 WHERE id = $1`
+	deleteCollectionQuery        = `DELETE FROM color_collections WHERE id = $1`
+
+	getCollectionColorsQuery    = `SELECT collection_id, name, hex, product_id FROM collection_colors WHERE collection_id = ANY($1::INTEGER[]) ORDER BY collection_id, position`
+	deleteCollectionColorsQuery = `DELETE FROM collection_colors WHERE collection_id = $1`
+	insertCollectionColorQuery  = `INSERT INTO collection_colors (collection_id, position, name, hex, product_id) values ($1, $2, $3, $4, $5)`
+)
+
+func NewCollectionsTable(db *pgxpool.Pool) *CollectionsTable {
+	return &CollectionsTable{db}
+}
+
+func (t *CollectionsTable) GetAll(publishedOnly bool) ([]Collection, error) {
+	query := getAllCollectionsQuery
+	if publishedOnly {
+		query = getPublishedCollectionsQuery
+	}
+
+	rows, err := t.db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Collection
+	for rows.Next() {
+		var c Collection
+
+		err = rows.Scan(&c.Id, &c.Name, &c.Description, &c.CoverImage, &c.PublishFrom, &c.PublishTo)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, c)
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	err = t.fillColors(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (t *CollectionsTable) GetById(id uint, publishedOnly bool) (Collection, error) {
+	query := getCollectionQuery
+	if publishedOnly {
+		query = getPublishedCollectionQuery
+	}
+
+	var c Collection
+	err := t.db.QueryRow(context.Background(), query, id).Scan(&c.Id, &c.Name, &c.Description, &c.CoverImage, &c.PublishFrom, &c.PublishTo)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	res := []Collection{c}
+	err = t.fillColors(res)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	return res[0], nil
+}
+
+func (t *CollectionsTable) fillColors(collections []Collection) error {
+	if len(collections) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(collections))
+	indexes := make(map[uint]int, len(collections))
+	for i, c := range collections {
+		ids = append(ids, c.Id)
+		indexes[c.Id] = i
+		collections[i].Colors = []CollectionColor{}
+	}
+
+	rows, err := t.db.Query(context.Background(), getCollectionColorsQuery, ids)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var collectionId uint
+		var color CollectionColor
+		var productId *uint
+
+		err = rows.Scan(&collectionId, &color.Name, &color.Hex, &productId)
+		if err != nil {
+			return err
+		}
+
+		if productId != nil {
+			color.ProductId = *productId
+		}
+
+		i := indexes[collectionId]
+		collections[i].Colors = append(collections[i].Colors, color)
+	}
+
+	rows.Close()
+
+	return rows.Err()
+}
+
+// Insert creates or updates the collection and replaces its colors keeping the passed order
+func (t *CollectionsTable) Insert(c Collection, editFlag bool) error {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = checkCollectionProducts(tx, c)
+	if err != nil {
+		return err
+	}
+
+	if editFlag {
+		var tag pgconn.CommandTag
+		tag, err = tx.Exec(context.Background(), updateCollectionQuery, c.Id, c.Name, c.Description, c.CoverImage, c.PublishFrom, c.PublishTo)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+	} else {
+		err = tx.QueryRow(context.Background(), insertCollectionQuery, c.Name, c.Description, c.CoverImage, c.PublishFrom, c.PublishTo).Scan(&c.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(context.Background(), deleteCollectionColorsQuery, c.Id)
+	if err != nil {
+		return err
+	}
+
+	for i, color := range c.Colors {
+		var productId *uint
+		if color.ProductId != 0 {
+			productId = &color.ProductId
+		}
+
+		_, err = tx.Exec(context.Background(), insertCollectionColorQuery, c.Id, i, color.Name, color.Hex, productId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// checkCollectionProducts makes sure the products of the colors exist
+func checkCollectionProducts(q querier, c Collection) error {
+	if len(c.Colors) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(c.Colors))
+	for _, color := range c.Colors {
+		ids = append(ids, color.ProductId)
+	}
+
+	var count int
+	err := q.QueryRow(context.Background(), countProductsIdsQuery, ids).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count != len(uniqueIds(ids)) {
+		return ErrUnknownCollectionProduct
+	}
+
+	return nil
+}
+
+func (t *CollectionsTable) Delete(id uint) error {
+	_, err := t.db.Exec(context.Background(), deleteCollectionQuery, id)
+	return err
+}
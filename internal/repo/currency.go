@@ -2,12 +2,19 @@ package repo
 
 import (
 	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
 )
 
 type Currency struct {
-	Id   uint   `json:"id"`
-	Name string `json:"name"`
+	Id         uint   `json:"id"`
+	Name       string `json:"name"`
+	Code       string `json:"code"`
+	Symbol     string `json:"symbol"`
+	MinorUnits uint8  `json:"minorUnits"`
+	Default    bool   `json:"default"`
 }
 
 type CurrencyTable struct {
@@ -15,10 +22,15 @@ type CurrencyTable struct {
 }
 
 const (
-	getCurrencyAllQuery = `SELECT * FROM currency`
-	insertCurrencyQuery = `INSERT INTO currency (name) values ($1)`
-	updateCurrencyQuery = `UPDATE currency SET name = $2 WHERE id = $1`
-	deleteCurrencyQuery = `DELETE FROM currency WHERE id = $1`
+	currencyColumns = `id, name, COALESCE(code, ''), COALESCE(symbol, ''), minor_units, is_default`
+
+	getCurrencyAllQuery     = `SELECT ` + currencyColumns + ` FROM currency ORDER BY is_default DESC, id`
+	getCurrencyByIdQuery    = `SELECT ` + currencyColumns + ` FROM currency WHERE id = $1`
+	getDefaultCurrencyQuery = `SELECT ` + currencyColumns + ` FROM currency WHERE is_default`
+	insertCurrencyQuery     = `INSERT INTO currency (name, code, symbol, minor_units, is_default) values ($1, $2, $3, $4, $5) RETURNING id`
+	updateCurrencyQuery     = `UPDATE currency SET name = $2, code = $3, symbol = $4, minor_units = $5, is_default = $6 WHERE id = $1`
+	resetDefaultQuery       = `UPDATE currency SET is_default = FALSE WHERE is_default AND id <> $1`
+	deleteCurrencyQuery     = `DELETE FROM currency WHERE id = $1`
 )
 
 func NewCurrencyTable(db *pgxpool.Pool) *CurrencyTable {
@@ -35,7 +47,7 @@ func (t *CurrencyTable) GetAllCurrency() ([]Currency, error) {
 	for rows.Next() {
 		var c Currency
 
-		err = rows.Scan(&c.Id, &c.Name)
+		c, err = scanCurrency(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -48,19 +60,82 @@ func (t *CurrencyTable) GetAllCurrency() ([]Currency, error) {
 	return res, rows.Err()
 }
 
+func (t *CurrencyTable) GetById(id uint) (Currency, error) {
+	return scanCurrency(t.db.QueryRow(context.Background(), getCurrencyByIdQuery, id))
+}
+
+func (t *CurrencyTable) GetDefault() (Currency, error) {
+	return scanCurrency(t.db.QueryRow(context.Background(), getDefaultCurrencyQuery))
+}
+
+func scanCurrency(row pgx.Row) (Currency, error) {
+	var c Currency
+	err := row.Scan(&c.Id, &c.Name, &c.Code, &c.Symbol, &c.MinorUnits, &c.Default)
+	return c, err
+}
+
 func (t *CurrencyTable) Insert(c Currency, editFlag bool) error {
-	var err error
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
 
 	if editFlag {
-		_, err = t.db.Exec(context.Background(), updateCurrencyQuery, c.Id, c.Name)
+		_, err = tx.Exec(context.Background(), updateCurrencyQuery, c.Id, c.Name, c.Code, c.Symbol, c.MinorUnits, c.Default)
+	} else {
+		err = tx.QueryRow(context.Background(), insertCurrencyQuery, c.Name, c.Code, c.Symbol, c.MinorUnits, c.Default).Scan(&c.Id)
+	}
+
+	if err != nil {
 		return err
 	}
 
-	_, err = t.db.Exec(context.Background(), insertCurrencyQuery, c.Name)
-	return err
+	// only one currency can be the default one
+	if c.Default {
+		_, err = tx.Exec(context.Background(), resetDefaultQuery, c.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
 }
 
 func (t *CurrencyTable) Delete(id uint) error {
 	_, err := t.db.Exec(context.Background(), deleteCurrencyQuery, id)
 	return err
 }
+
+// Format renders the amount rounded to the currency precision with grouped
+// thousands, decimal comma and the symbol after the number, e.g. "1 299,90 ₽"
+func (c Currency) Format(amount Money) string {
+	str := amount.Fixed(c.MinorUnits)
+
+	negative := strings.HasPrefix(str, "-")
+	integer, fraction, _ := strings.Cut(strings.TrimPrefix(str, "-"), ".")
+
+	var builder strings.Builder
+	if negative {
+		builder.WriteByte('-')
+	}
+
+	for i, digit := range integer {
+		if i != 0 && (len(integer)-i)%3 == 0 {
+			builder.WriteRune('\u00a0')
+		}
+		builder.WriteRune(digit)
+	}
+
+	if len(fraction) != 0 {
+		builder.WriteByte(',')
+		builder.WriteString(fraction)
+	}
+
+	symbol := c.Symbol
+	if len(symbol) == 0 {
+		symbol = c.Code
+	}
+
+	return fmt.Sprintf("%s\u00a0%s", builder.String(), symbol)
+}
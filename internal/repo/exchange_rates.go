@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type ExchangeRate struct {
+	Id            uint      `json:"id"`
+	From          uint      `json:"from"`
+	To            uint      `json:"to"`
+	Rate          Rate      `json:"rate"`
+	EffectiveDate time.Time `json:"effectiveDate"`
+}
+
+type ExchangeRatesTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	exchangeRateColumns = `id, from_currency, to_currency, rate, effective_date`
+
+	getAllExchangeRatesQuery       = `SELECT ` + exchangeRateColumns + ` FROM exchange_rates ORDER BY effective_date DESC, from_currency, to_currency`
+	getEffectiveExchangeRatesQuery = `SELECT DISTINCT ON (from_currency, to_currency) ` + exchangeRateColumns + ` FROM exchange_rates
+									  WHERE effective_date <= $1
+									  ORDER BY from_currency, to_currency, effective_date DESC`
+	upsertExchangeRateQuery = `INSERT INTO exchange_rates (from_currency, to_currency, rate, effective_date) values ($1, $2, $3, $4)
+							   ON CONFLICT (from_currency, to_currency, effective_date) DO UPDATE SET rate = excluded.rate`
+	deleteExchangeRateQuery = `DELETE FROM exchange_rates WHERE id = $1`
+)
+
+func NewExchangeRatesTable(db *pgxpool.Pool) *ExchangeRatesTable {
+	return &ExchangeRatesTable{db}
+}
+
+func (t *ExchangeRatesTable) GetAll() ([]ExchangeRate, error) {
+	return t.query(getAllExchangeRatesQuery)
+}
+
+// GetEffective returns the latest rate of every currency pair known at the date
+func (t *ExchangeRatesTable) GetEffective(date time.Time) (RateSet, error) {
+	rates, err := t.query(getEffectiveExchangeRatesQuery, date)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(RateSet, len(rates))
+	for _, r := range rates {
+		set[[2]uint{r.From, r.To}] = r
+	}
+
+	return set, nil
+}
+
+func (t *ExchangeRatesTable) query(query string, args ...any) ([]ExchangeRate, error) {
+	rows, err := t.db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []ExchangeRate
+	for rows.Next() {
+		var r ExchangeRate
+
+		err = rows.Scan(&r.Id, &r.From, &r.To, &r.Rate, &r.EffectiveDate)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, r)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+// Upsert stores the rates replacing the ones of the same pairs and dates
+func (t *ExchangeRatesTable) Upsert(rates []ExchangeRate) error {
+	batch := &pgx.Batch{}
+	for _, r := range rates {
+		batch.Queue(upsertExchangeRateQuery, r.From, r.To, r.Rate, r.EffectiveDate)
+	}
+
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = tx.SendBatch(context.Background(), batch).Close()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (t *ExchangeRatesTable) Delete(id uint) error {
+	_, err := t.db.Exec(context.Background(), deleteExchangeRateQuery, id)
+	return err
+}
+
+// Conversion is the rate to multiply amounts by and the date it is effective from
+type Conversion struct {
+	Rate Rate
+	Date time.Time
+}
+
+// RateSet holds the effective rates by (from, to) currency pair
+type RateSet map[[2]uint]ExchangeRate
+
+// Find looks for a direct rate, then for an inverse one and finally for a cross
+// rate through any other currency, preferring the freshest one
+func (s RateSet) Find(from uint, to uint) (Conversion, bool) {
+	if from == to {
+		return Conversion{Rate: NewRate(1, 1)}, true
+	}
+
+	if c, ok := s.leg(from, to); ok {
+		return c, true
+	}
+
+	var best Conversion
+	var bestVia uint
+	var found bool
+	for pair := range s {
+		for _, via := range pair {
+			if via == from || via == to {
+				continue
+			}
+
+			first, ok := s.leg(from, via)
+			if !ok {
+				continue
+			}
+
+			second, ok := s.leg(via, to)
+			if !ok {
+				continue
+			}
+
+			c := Conversion{Rate: first.Rate.Mul(second.Rate), Date: first.Date}
+			if second.Date.Before(c.Date) {
+				c.Date = second.Date
+			}
+
+			if !found || c.Date.After(best.Date) || c.Date.Equal(best.Date) && via < bestVia {
+				best, bestVia, found = c, via, true
+			}
+		}
+	}
+
+	return best, found
+}
+
+func (s RateSet) leg(from uint, to uint) (Conversion, bool) {
+	if r, ok := s[[2]uint{from, to}]; ok {
+		return Conversion{Rate: r.Rate, Date: r.EffectiveDate}, true
+	}
+
+	if r, ok := s[[2]uint{to, from}]; ok {
+		return Conversion{Rate: r.Rate.Inverse(), Date: r.EffectiveDate}, true
+	}
+
+	return Conversion{}, false
+}
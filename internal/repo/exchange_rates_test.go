@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateSetFind(t *testing.T) {
+	const (
+		rub = iota + 1
+		usd
+		eur
+		cny
+		kzt
+	)
+
+	day := func(d int) time.Time {
+		return time.Date(2026, time.October, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	mustRate := func(s string) Rate {
+		r, err := ParseRate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	set := RateSet{}
+	for _, r := range []ExchangeRate{
+		{From: usd, To: rub, Rate: mustRate("80"), EffectiveDate: day(19)},
+		{From: eur, To: rub, Rate: mustRate("100"), EffectiveDate: day(18)},
+		{From: cny, To: rub, Rate: mustRate("11"), EffectiveDate: day(17)},
+		{From: cny, To: usd, Rate: mustRate("0.14"), EffectiveDate: day(19)},
+	} {
+		set[[2]uint{r.From, r.To}] = r
+	}
+
+	tests := []struct {
+		name     string
+		from, to uint
+		rate     string
+		date     time.Time
+		found    bool
+	}{
+		{name: "same currency", from: rub, to: rub, rate: "1", found: true},
+		{name: "direct", from: usd, to: rub, rate: "80", date: day(19), found: true},
+		{name: "inverse", from: rub, to: usd, rate: "0.0125", date: day(19), found: true},
+		{name: "cross through rub", from: usd, to: eur, rate: "0.8", date: day(18), found: true},
+		{name: "cross inverse", from: eur, to: usd, rate: "1.25", date: day(18), found: true},
+		// a cross rate is as old as its older leg
+		{name: "cross date", from: cny, to: eur, rate: "0.11", date: day(17), found: true},
+		// both rub and cny lead to usd, the direct rate is preferred over any cross one
+		{name: "direct over cross", from: cny, to: usd, rate: "0.14", date: day(19), found: true},
+		{name: "unknown", from: kzt, to: rub, found: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := set.Find(tt.from, tt.to)
+		if ok != tt.found {
+			t.Errorf("%s: found %v, want %v", tt.name, ok, tt.found)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if got.Rate.String() != tt.rate || !got.Date.Equal(tt.date) {
+			t.Errorf("%s: got %s at %v, want %s at %v", tt.name, got.Rate, got.Date, tt.rate, tt.date)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DuplicateGroup is a set of images with the same content
+type DuplicateGroup struct {
+	Hash  string   `json:"hash"`
+	Size  int64    `json:"size"`
+	Names []string `json:"names"`
+}
+
+type ImageHashesTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	getNamesByHashQuery  = `SELECT name FROM image_hashes WHERE hash = $1 ORDER BY created_at, name`
+	getHashedNamesQuery  = `SELECT name FROM image_hashes`
+	upsertImageHashQuery = `INSERT INTO image_hashes (name, hash, size) values ($1, $2, $3)
+							ON CONFLICT (name) DO UPDATE SET hash = excluded.hash, size = excluded.size, created_at = now()`
+	deleteImageHashQuery = `DELETE FROM image_hashes WHERE name = $1`
+	getDuplicatesQuery   = `SELECT hash, MAX(size), ARRAY_AGG(name ORDER BY created_at, name) FROM image_hashes
+							GROUP BY hash HAVING count(*) > 1
+							ORDER BY MAX(size) * (count(*) - 1) DESC, hash`
+)
+
+func NewImageHashesTable(db *pgxpool.Pool) *ImageHashesTable {
+	return &ImageHashesTable{db}
+}
+
+// GetNamesByHash returns the images with the content hash, the oldest first
+func (t *ImageHashesTable) GetNamesByHash(hash string) ([]string, error) {
+	return t.queryNames(getNamesByHashQuery, hash)
+}
+
+// GetHashedNames returns the names of all indexed images
+func (t *ImageHashesTable) GetHashedNames() ([]string, error) {
+	return t.queryNames(getHashedNamesQuery)
+}
+
+func (t *ImageHashesTable) queryNames(query string, args ...any) ([]string, error) {
+	rows, err := t.db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, name)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+func (t *ImageHashesTable) Upsert(name string, hash string, size int) error {
+	_, err := t.db.Exec(context.Background(), upsertImageHashQuery, name, hash, size)
+	return err
+}
+
+func (t *ImageHashesTable) Delete(name string) error {
+	_, err := t.db.Exec(context.Background(), deleteImageHashQuery, name)
+	return err
+}
+
+// GetDuplicates returns the groups of images sharing the content, the most wasteful first
+func (t *ImageHashesTable) GetDuplicates() ([]DuplicateGroup, error) {
+	rows, err := t.db.Query(context.Background(), getDuplicatesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []DuplicateGroup
+	for rows.Next() {
+		var g DuplicateGroup
+
+		err = rows.Scan(&g.Hash, &g.Size, &g.Names)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, g)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ImagePalettesTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	getPalettesQuery   = `SELECT name, colors FROM image_palettes WHERE name = ANY($1::VARCHAR[])`
+	upsertPaletteQuery = `INSERT INTO image_palettes (name, colors) values ($1, $2) ON CONFLICT (name) DO UPDATE SET colors = excluded.colors`
+	deletePaletteQuery = `DELETE FROM image_palettes WHERE name = $1`
+)
+
+func NewImagePalettesTable(db *pgxpool.Pool) *ImagePalettesTable {
+	return &ImagePalettesTable{db}
+}
+
+// GetByNames returns palettes of the images that have one, keyed by image name
+func (t *ImagePalettesTable) GetByNames(names []string) (map[string][]string, error) {
+	rows, err := t.db.Query(context.Background(), getPalettesQuery, names)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]string, len(names))
+	for rows.Next() {
+		var name string
+		var colors []string
+
+		err = rows.Scan(&name, &colors)
+		if err != nil {
+			return nil, err
+		}
+
+		res[name] = colors
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+func (t *ImagePalettesTable) Upsert(name string, colors []string) error {
+	_, err := t.db.Exec(context.Background(), upsertPaletteQuery, name, colors)
+	return err
+}
+
+func (t *ImagePalettesTable) Delete(name string) error {
+	_, err := t.db.Exec(context.Background(), deletePaletteQuery, name)
+	return err
+}
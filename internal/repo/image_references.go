@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ImageReference is a row that points to an image of the bucket
+type ImageReference struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	Id    uint   `json:"id"`
+}
+
+type ImageReferencesTable struct {
+	db *pgxpool.Pool
+}
+
+const getImageReferencesQuery = `SELECT name, source, id FROM (
+									 SELECT unnest(images) AS name, 'products' AS source, id FROM products
+									 UNION ALL
+									 SELECT image, 'subjects', id FROM subjects
+									 UNION ALL
+									 SELECT logo, 'brands', id FROM brands
+									 UNION ALL
+									 SELECT cover_image, 'color_collections', id FROM color_collections
+								 ) refs
+								 WHERE name IS NOT NULL AND name <> ''
+								 ORDER BY name, source, id`
+
+func NewImageReferencesTable(db *pgxpool.Pool) *ImageReferencesTable {
+	return &ImageReferencesTable{db}
+}
+
+// GetAll returns every image reference of products, subjects, brands and collections
+func (t *ImageReferencesTable) GetAll() ([]ImageReference, error) {
+	rows, err := t.db.Query(context.Background(), getImageReferencesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []ImageReference
+	for rows.Next() {
+		var r ImageReference
+
+		err = rows.Scan(&r.Name, &r.Table, &r.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, r)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
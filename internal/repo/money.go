@@ -0,0 +1,192 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// moneyScale is the number of decimal digits Money keeps
+const moneyScale = 4
+
+var (
+	ErrInvalidMoney = errors.New("invalid money amount")
+
+	moneyFactor = pow10(moneyScale)
+)
+
+// Money is an exact decimal amount stored as an integer number of 1/10000 units.
+// It is read and written as NUMERIC and marshalled to JSON as an exact decimal number.
+type Money int64
+
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	integer, fraction, _ := strings.Cut(s, ".")
+	if len(integer) == 0 && len(fraction) == 0 || len(fraction) > moneyScale {
+		return 0, ErrInvalidMoney
+	}
+
+	fraction += strings.Repeat("0", moneyScale-len(fraction))
+
+	value, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil || strings.ContainsAny(integer+fraction, "+-") {
+		return 0, ErrInvalidMoney
+	}
+
+	if negative {
+		value = -value
+	}
+
+	return Money(value), nil
+}
+
+// Round rounds the amount half away from zero to the passed number of decimal digits
+func (m Money) Round(digits uint8) Money {
+	if digits >= moneyScale {
+		return m
+	}
+
+	unit := pow10(moneyScale - int(digits))
+	return Money(divRound(int64(m), unit) * unit)
+}
+
+// Discount returns the amount reduced by the percent
+func (m Money) Discount(percent uint8) Money {
+	return Money(divRound(int64(m)*int64(100-int(percent)), 100))
+}
+
+// Convert multiplies the amount by the exact exchange rate and rounds the result
+// half away from zero to the passed number of decimal digits
+func (m Money) Convert(rate Rate, digits uint8) Money {
+	if digits > moneyScale {
+		digits = moneyScale
+	}
+
+	unit := pow10(moneyScale - int(digits))
+	value := new(big.Rat).Mul(big.NewRat(int64(m), unit), rate.rat())
+
+	return Money(roundRat(value).Int64() * unit)
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / float64(moneyFactor)
+}
+
+// Fixed formats the amount with exactly the passed number of decimal digits, rounding if needed
+func (m Money) Fixed(digits uint8) string {
+	if digits > moneyScale {
+		digits = moneyScale
+	}
+
+	value := int64(m.Round(digits))
+
+	sign := ""
+	if value < 0 {
+		sign, value = "-", -value
+	}
+
+	integer := strconv.FormatInt(value/moneyFactor, 10)
+	if digits == 0 {
+		return sign + integer
+	}
+
+	fraction := fmt.Sprintf("%0*d", moneyScale, value%moneyFactor)
+	return sign + integer + "." + fraction[:digits]
+}
+
+// String formats the amount without trailing zeros
+func (m Money) String() string {
+	s := m.Fixed(moneyScale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both numbers and decimal strings
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	value, err := ParseMoney(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+
+	*m = value
+	return nil
+}
+
+func (m *Money) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		*m = 0
+		return nil
+	}
+
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return ErrInvalidMoney
+	}
+
+	value := new(big.Int).Set(v.Int)
+	exp := int(v.Exp) + moneyScale
+	if exp >= 0 {
+		value.Mul(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil))
+	} else {
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-exp)), nil)
+
+		// round half away from zero
+		quotient, remainder := new(big.Int).QuoRem(value, divisor, new(big.Int))
+		if remainder.Mul(remainder.Abs(remainder), big.NewInt(2)).Cmp(divisor) >= 0 {
+			quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+		}
+
+		value = quotient
+	}
+
+	if !value.IsInt64() {
+		return ErrInvalidMoney
+	}
+
+	*m = Money(value.Int64())
+	return nil
+}
+
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(m)), Exp: -moneyScale, Valid: true}, nil
+}
+
+func divRound(value int64, divisor int64) int64 {
+	quotient, remainder := value/divisor, value%divisor
+	if remainder < 0 {
+		remainder = -remainder
+	}
+
+	if remainder*2 >= divisor {
+		if value < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+
+	return quotient
+}
+
+func pow10(n int) int64 {
+	res := int64(1)
+	for i := 0; i < n; i++ {
+		res *= 10
+	}
+
+	return res
+}
@@ -0,0 +1,188 @@
+package repo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{in: "0", want: 0},
+		{in: "1299.9", want: 12999000},
+		{in: "1299.90", want: 12999000},
+		{in: "-0.0001", want: -1},
+		{in: "+5", want: 50000},
+		{in: ".5", want: 5000},
+		{in: " 12.34 ", want: 123400},
+		{in: "", err: true},
+		{in: ".", err: true},
+		{in: "1.23456", err: true},
+		{in: "1,5", err: true},
+		{in: "--1", err: true},
+		{in: "1.-5", err: true},
+		{in: "abc", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseMoney(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		m      Money
+		digits uint8
+		fixed  string
+		str    string
+	}{
+		{m: 12999000, digits: 2, fixed: "1299.90", str: "1299.9"},
+		{m: 12345, digits: 2, fixed: "1.23", str: "1.2345"},
+		{m: 12350, digits: 2, fixed: "1.24", str: "1.235"},
+		{m: -12350, digits: 2, fixed: "-1.24", str: "-1.235"},
+		{m: 15000, digits: 0, fixed: "2", str: "1.5"},
+		{m: 0, digits: 2, fixed: "0.00", str: "0"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Fixed(tt.digits); got != tt.fixed {
+			t.Errorf("Money(%d).Fixed(%d) = %q, want %q", tt.m, tt.digits, got, tt.fixed)
+		}
+
+		if got := tt.m.String(); got != tt.str {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.m, got, tt.str)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var p struct {
+		Price Money `json:"price"`
+		Old   Money `json:"old"`
+	}
+
+	err := json.Unmarshal([]byte(`{"price": "1299.90", "old": 0.1}`), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Price != 12999000 || p.Old != 1000 {
+		t.Fatalf("unmarshalled %d and %d", p.Price, p.Old)
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"price":1299.9,"old":0.1}` {
+		t.Fatalf("marshalled %s", data)
+	}
+}
+
+func TestMoneyDiscount(t *testing.T) {
+	tests := []struct {
+		m       Money
+		percent uint8
+		want    Money
+	}{
+		{m: 12999000, percent: 0, want: 12999000},
+		{m: 12999000, percent: 15, want: 11049150},
+		{m: 12999000, percent: 100, want: 0},
+		// 0.0005 * 0.5 rounds half away from zero
+		{m: 5, percent: 50, want: 3},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Discount(tt.percent); got != tt.want {
+			t.Errorf("Money(%d).Discount(%d) = %d, want %d", tt.m, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	usd, err := ParseRate("92.5012")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		m      Money
+		rate   Rate
+		digits uint8
+		want   string
+	}{
+		{name: "direct", m: 12999000, rate: usd, digits: 2, want: "120242.31"},
+		{name: "inverse", m: 12999000, rate: usd.Inverse(), digits: 2, want: "14.05"},
+		{name: "no minor units", m: 12999000, rate: usd, digits: 0, want: "120242"},
+		{name: "discount", m: 12999000, rate: usd.Discount(15), digits: 2, want: "102205.96"},
+		{name: "exact third", m: 30000, rate: NewRate(1, 3), digits: 4, want: "1.0000"},
+		// a float64 rate gives 2.675 * 1 = 2.67499..., the exact one rounds up
+		{name: "half up", m: 26750, rate: NewRate(1, 1), digits: 2, want: "2.68"},
+		{name: "negative", m: -26750, rate: NewRate(1, 1), digits: 2, want: "-2.68"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Convert(tt.rate, tt.digits).Fixed(tt.digits); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyNumeric(t *testing.T) {
+	for _, m := range []Money{0, 1, -1, 12999000, 1 << 40} {
+		n, err := m.NumericValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var back Money
+		err = back.ScanNumeric(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if back != m {
+			t.Errorf("round trip of %d gave %d", m, back)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "92.5012", want: "92.5012"},
+		{in: "1", want: "1"},
+		{in: "0.00000000005", want: "0.0000000001"},
+		{in: "1/3", err: true},
+		{in: "1e3", err: true},
+		{in: "", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseRate(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+
+		if err == nil && got.String() != tt.want {
+			t.Errorf("ParseRate(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type PriceBatchStatus string
+
+const (
+	BatchPending   PriceBatchStatus = "pending"
+	BatchApplied   PriceBatchStatus = "applied"
+	BatchCancelled PriceBatchStatus = "cancelled"
+)
+
+var (
+	ErrBatchNotPending    = errors.New("price batch is not pending")
+	ErrUnknownBatchTarget = errors.New("price batch targets unknown brand, subject or products")
+)
+
+type PriceBatchItem struct {
+	ProductId uint  `json:"product"`
+	Price     Money `json:"price"`
+}
+
+// PriceBatch either sets the prices of the listed products or changes the
+// prices of a brand or a subject subtree by the percent
+type PriceBatch struct {
+	Id          uint             `json:"id"`
+	Name        string           `json:"name"`
+	EffectiveAt time.Time        `json:"effectiveAt"`
+	Status      PriceBatchStatus `json:"status"`
+
+	Items     []PriceBatchItem `json:"items"`
+	Percent   *float64         `json:"percent"`
+	BrandId   uint             `json:"brand"`
+	SubjectId uint             `json:"subject"`
+
+	CreatedAt       time.Time  `json:"createdAt"`
+	AppliedAt       *time.Time `json:"appliedAt"`
+	ChangedProducts int        `json:"changedProducts"`
+}
+
+type PriceBatchChange struct {
+	ProductId   uint   `json:"product"`
+	ProductName string `json:"productName"`
+	Currency    uint   `json:"currency"`
+	OldPrice    Money  `json:"oldPrice"`
+	NewPrice    Money  `json:"newPrice"`
+}
+
+type PriceBatchesTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	priceBatchColumns = `id, name, effective_at, status, rule_percent, COALESCE(rule_brand_id, 0), COALESCE(rule_subject_id, 0), created_at, applied_at, changed_products`
+
+	getAllPriceBatchesQuery   = `SELECT ` + priceBatchColumns + ` FROM price_batches ORDER BY effective_at DESC, id DESC`
+	getPriceBatchQuery        = `SELECT ` + priceBatchColumns + ` FROM price_batches WHERE id = $1`
+	getPriceBatchItemsQuery   = `SELECT product_id, price FROM price_batch_items WHERE batch_id = $1 ORDER BY product_id`
+	insertPriceBatchQuery     = `INSERT INTO price_batches (name, effective_at, rule_percent, rule_brand_id, rule_subject_id) values ($1, $2, $3, $4, $5) RETURNING id`
+	insertPriceBatchItemQuery = `INSERT INTO price_batch_items (batch_id, product_id, price) values ($1, $2, $3)`
+	cancelPriceBatchQuery     = `UPDATE price_batches SET status = 'cancelled' WHERE id = $1 AND status = 'pending'`
+	priceBatchExistsQuery     = `SELECT EXISTS (SELECT 1 FROM price_batches WHERE id = $1)`
+
+	brandExistsQuery      = `SELECT EXISTS (SELECT 1 FROM brands WHERE id = $1)`
+	subjectExistsQuery    = `SELECT EXISTS (SELECT 1 FROM subjects WHERE id = $1)`
+	countProductsIdsQuery = `SELECT count(*) FROM products WHERE id = ANY($1::INTEGER[])`
+
+	getSubjectsPendingBatchesQuery = `SELECT id FROM price_batches WHERE status = 'pending' AND rule_subject_id = ANY($1::INTEGER[]) ORDER BY id`
+	getBrandsPendingBatchesQuery   = `SELECT id FROM price_batches WHERE status = 'pending' AND rule_brand_id = ANY($1::INTEGER[]) ORDER BY id`
+	cancelPriceBatchesQuery        = `UPDATE price_batches SET status = 'cancelled' WHERE id = ANY($1::INTEGER[]) AND status = 'pending'`
+
+	lockDuePriceBatchQuery = `SELECT id FROM price_batches WHERE status = 'pending' AND effective_at <= now()
+							  ORDER BY effective_at, id LIMIT 1 FOR UPDATE SKIP LOCKED`
+	finishPriceBatchQuery = `UPDATE price_batches SET status = 'applied', applied_at = now(), changed_products = $2 WHERE id = $1`
+
+	// batchTargetsCTE resolves the new price of every product the batch touches
+	batchTargetsCTE = `WITH RECURSIVE subtree AS (
+						   SELECT rule_subject_id AS id, 1 AS level FROM price_batches WHERE id = $1 AND rule_subject_id IS NOT NULL
+						   UNION ALL
+						   SELECT s.id, st.level + 1 FROM subjects s
+						   JOIN subtree st ON s.parent_id = st.id
+						   WHERE st.level < 64
+					   ), targets AS (
+						   SELECT p.id, p.name, p.currency, p.price, i.price AS new_price
+						   FROM price_batch_items i
+						   JOIN products p ON p.id = i.product_id
+						   WHERE i.batch_id = $1
+						   UNION ALL
+						   SELECT p.id, p.name, p.currency, p.price, round(p.price * (100 + b.rule_percent) / 100, COALESCE(c.minor_units, 2))
+						   FROM price_batches b
+						   JOIN products p ON p.brand_id = b.rule_brand_id OR p.subject_id IN (SELECT id FROM subtree)
+						   LEFT JOIN currency c ON c.id = p.currency
+						   WHERE b.id = $1 AND b.rule_percent IS NOT NULL
+					   )`
+	previewPriceBatchQuery = batchTargetsCTE + ` SELECT id, name, COALESCE(currency, 0), price, new_price FROM targets ORDER BY id`
+	applyPriceBatchQuery   = batchTargetsCTE + ` UPDATE products p SET price = t.new_price FROM targets t WHERE p.id = t.id AND p.price <> t.new_price`
+)
+
+func NewPriceBatchesTable(db *pgxpool.Pool) *PriceBatchesTable {
+	return &PriceBatchesTable{db}
+}
+
+func (t *PriceBatchesTable) GetAll() ([]PriceBatch, error) {
+	rows, err := t.db.Query(context.Background(), getAllPriceBatchesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []PriceBatch
+	for rows.Next() {
+		var b PriceBatch
+
+		b, err = scanPriceBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, b)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+func (t *PriceBatchesTable) GetById(id uint) (PriceBatch, error) {
+	b, err := scanPriceBatch(t.db.QueryRow(context.Background(), getPriceBatchQuery, id))
+	if err != nil {
+		return PriceBatch{}, err
+	}
+
+	rows, err := t.db.Query(context.Background(), getPriceBatchItemsQuery, id)
+	if err != nil {
+		return PriceBatch{}, err
+	}
+
+	b.Items = []PriceBatchItem{}
+	for rows.Next() {
+		var item PriceBatchItem
+
+		err = rows.Scan(&item.ProductId, &item.Price)
+		if err != nil {
+			return PriceBatch{}, err
+		}
+
+		b.Items = append(b.Items, item)
+	}
+
+	rows.Close()
+
+	return b, rows.Err()
+}
+
+func scanPriceBatch(row pgx.Row) (PriceBatch, error) {
+	var b PriceBatch
+	err := row.Scan(&b.Id, &b.Name, &b.EffectiveAt, &b.Status, &b.Percent, &b.BrandId, &b.SubjectId, &b.CreatedAt, &b.AppliedAt, &b.ChangedProducts)
+	return b, err
+}
+
+func (t *PriceBatchesTable) Insert(b PriceBatch) (uint, error) {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = checkBatchTargets(tx, b)
+	if err != nil {
+		return 0, err
+	}
+
+	var id uint
+	err = tx.QueryRow(context.Background(), insertPriceBatchQuery, b.Name, b.EffectiveAt, b.Percent, nullableId(b.BrandId), nullableId(b.SubjectId)).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range b.Items {
+		_, err = tx.Exec(context.Background(), insertPriceBatchItemQuery, id, item.ProductId, item.Price)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit(context.Background())
+}
+
+// checkBatchTargets makes sure the brand, the subject and the products of the batch exist
+func checkBatchTargets(q querier, b PriceBatch) error {
+	targets := []struct {
+		id    uint
+		query string
+	}{
+		{b.BrandId, brandExistsQuery},
+		{b.SubjectId, subjectExistsQuery},
+	}
+
+	for _, target := range targets {
+		if target.id == 0 {
+			continue
+		}
+
+		var exists bool
+		err := q.QueryRow(context.Background(), target.query, target.id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return ErrUnknownBatchTarget
+		}
+	}
+
+	if len(b.Items) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(b.Items))
+	for _, item := range b.Items {
+		ids = append(ids, item.ProductId)
+	}
+
+	var count int
+	err := q.QueryRow(context.Background(), countProductsIdsQuery, ids).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count != len(uniqueIds(ids)) {
+		return ErrUnknownBatchTarget
+	}
+
+	return nil
+}
+
+// getPendingBatches returns ids of the pending batches targeting the brands or the subjects
+func getPendingBatches(q querier, query string, targetIds []uint) ([]uint, error) {
+	rows, err := q.Query(context.Background(), query, targetIds)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []uint{}
+	for rows.Next() {
+		var id uint
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, id)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+func cancelBatches(q querier, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := q.Exec(context.Background(), cancelPriceBatchesQuery, ids)
+	return err
+}
+
+// Preview returns the prices the batch would set if it was applied now,
+// pgx.ErrNoRows if the batch doesn't exist
+func (t *PriceBatchesTable) Preview(id uint) ([]PriceBatchChange, error) {
+	rows, err := t.db.Query(context.Background(), previewPriceBatchQuery, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []PriceBatchChange
+	for rows.Next() {
+		var c PriceBatchChange
+
+		err = rows.Scan(&c.ProductId, &c.ProductName, &c.Currency, &c.OldPrice, &c.NewPrice)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, c)
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	if len(res) != 0 {
+		return res, nil
+	}
+
+	// a batch without changes is told apart from a missing one
+	var exists bool
+	err = t.db.QueryRow(context.Background(), priceBatchExistsQuery, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, pgx.ErrNoRows
+	}
+
+	return res, nil
+}
+
+func (t *PriceBatchesTable) Cancel(id uint) error {
+	tag, err := t.db.Exec(context.Background(), cancelPriceBatchQuery, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() != 0 {
+		return nil
+	}
+
+	var exists bool
+	err = t.db.QueryRow(context.Background(), priceBatchExistsQuery, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return pgx.ErrNoRows
+	}
+
+	return ErrBatchNotPending
+}
+
+// ApplyDue applies the pending batches whose time has come one by one in the order
+// of their effective time. Batches locked by another instance are skipped.
+func (t *PriceBatchesTable) ApplyDue() ([]PriceBatch, error) {
+	var applied []PriceBatch
+	for {
+		b, ok, err := t.applyNext()
+		if err != nil || !ok {
+			return applied, err
+		}
+
+		applied = append(applied, b)
+	}
+}
+
+func (t *PriceBatchesTable) applyNext() (PriceBatch, bool, error) {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return PriceBatch{}, false, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var b PriceBatch
+	err = tx.QueryRow(context.Background(), lockDuePriceBatchQuery).Scan(&b.Id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PriceBatch{}, false, nil
+	}
+	if err != nil {
+		return PriceBatch{}, false, err
+	}
+
+	tag, err := tx.Exec(context.Background(), applyPriceBatchQuery, b.Id)
+	if err != nil {
+		return PriceBatch{}, false, err
+	}
+
+	b.ChangedProducts = int(tag.RowsAffected())
+	_, err = tx.Exec(context.Background(), finishPriceBatchQuery, b.Id, b.ChangedProducts)
+	if err != nil {
+		return PriceBatch{}, false, err
+	}
+
+	return b, true, tx.Commit(context.Background())
+}
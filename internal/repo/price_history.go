@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// LowestPriceWindow is the period before the current price took effect
+// the lowest previous price of a product is looked for in
+const LowestPriceWindow = 30 * 24 * time.Hour
+
+type PriceHistoryEntry struct {
+	Price         Money     `json:"price"`
+	Discount      uint8     `json:"discount"`
+	DiscountPrice Money     `json:"discountPrice"`
+	Currency      uint      `json:"currency"`
+	ChangedAt     time.Time `json:"changedAt"`
+}
+
+type PriceChange struct {
+	ProductId   uint      `json:"product"`
+	ProductName string    `json:"productName"`
+	ChangedAt   time.Time `json:"changedAt"`
+
+	OldPrice    *Money `json:"oldPrice"`
+	OldDiscount *uint8 `json:"oldDiscount"`
+	OldCurrency *uint  `json:"oldCurrency"`
+
+	Price    Money `json:"price"`
+	Discount uint8 `json:"discount"`
+	Currency uint  `json:"currency"`
+}
+
+type PriceHistoryTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	getPriceHistoryQuery = `SELECT price, discount, COALESCE(currency, 0), changed_at FROM price_history
+							WHERE product_id = $1 AND changed_at >= $2 AND changed_at < $3
+							ORDER BY changed_at, id`
+	// the entry effective at the start of the period is a part of it as well
+	getPriceHistoryStartQuery = `SELECT price, discount, COALESCE(currency, 0), changed_at FROM price_history
+								 WHERE product_id = $1 AND changed_at < $2
+								 ORDER BY changed_at DESC, id DESC LIMIT 1`
+	getCurrentPriceChangedAtQuery = `SELECT changed_at FROM price_history WHERE product_id = $1
+									 ORDER BY changed_at DESC, id DESC LIMIT 1`
+	getPriceChangesQuery = `SELECT product_id, name, changed_at, old_price, old_discount, old_currency, price, discount, COALESCE(currency, 0) FROM (
+								SELECT h.product_id, p.name, h.changed_at, h.price, h.discount, h.currency,
+									   LAG(h.price) OVER w AS old_price, LAG(h.discount) OVER w AS old_discount, LAG(h.currency) OVER w AS old_currency
+								FROM price_history h
+								JOIN products p ON p.id = h.product_id
+								WHERE h.changed_at < $2
+								WINDOW w AS (PARTITION BY h.product_id ORDER BY h.changed_at, h.id)
+							) changes
+							WHERE changed_at >= $1
+							ORDER BY changed_at, product_id`
+)
+
+func NewPriceHistoryTable(db *pgxpool.Pool) *PriceHistoryTable {
+	return &PriceHistoryTable{db}
+}
+
+// GetByProductId returns the prices the product had in the period, starting
+// with the one effective at its beginning
+func (t *PriceHistoryTable) GetByProductId(productId uint, from time.Time, to time.Time) ([]PriceHistoryEntry, error) {
+	var res []PriceHistoryEntry
+
+	var start PriceHistoryEntry
+	err := t.db.QueryRow(context.Background(), getPriceHistoryStartQuery, productId, from).Scan(&start.Price, &start.Discount, &start.Currency, &start.ChangedAt)
+	if err == nil {
+		start.DiscountPrice = start.Price.Discount(start.Discount)
+		res = append(res, start)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err := t.db.Query(context.Background(), getPriceHistoryQuery, productId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var e PriceHistoryEntry
+
+		err = rows.Scan(&e.Price, &e.Discount, &e.Currency, &e.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		e.DiscountPrice = e.Price.Discount(e.Discount)
+		res = append(res, e)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+// GetLowestPrice returns the lowest discounted price the product had in the currency
+// during the LowestPriceWindow before its current price took effect. The current
+// price itself is left out, so false is returned until the price changes at least once.
+func (t *PriceHistoryTable) GetLowestPrice(productId uint, currency uint) (Money, bool, error) {
+	var current time.Time
+	err := t.db.QueryRow(context.Background(), getCurrentPriceChangedAtQuery, productId).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	history, err := t.GetByProductId(productId, current.Add(-LowestPriceWindow), current)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var lowest Money
+	var found bool
+	for _, e := range history {
+		if e.Currency != currency {
+			continue
+		}
+
+		if !found || e.DiscountPrice < lowest {
+			lowest, found = e.DiscountPrice, true
+		}
+	}
+
+	return lowest, found, nil
+}
+
+// GetChanges returns every price change made in the period together with the previous values
+func (t *PriceHistoryTable) GetChanges(from time.Time, to time.Time) ([]PriceChange, error) {
+	rows, err := t.db.Query(context.Background(), getPriceChangesQuery, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []PriceChange
+	for rows.Next() {
+		var c PriceChange
+
+		err = rows.Scan(&c.ProductId, &c.ProductName, &c.ChangedAt, &c.OldPrice, &c.OldDiscount, &c.OldCurrency, &c.Price, &c.Discount, &c.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, c)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
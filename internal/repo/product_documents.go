@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DocumentType string
+
+const (
+	TechnicalDataSheet DocumentType = "tds"
+	SafetyDataSheet    DocumentType = "sds"
+)
+
+func (t DocumentType) Valid() bool {
+	return t == TechnicalDataSheet || t == SafetyDataSheet
+}
+
+type ProductDocument struct {
+	Id        uint         `json:"id"`
+	Name      string       `json:"name"`
+	File      string       `json:"file"`
+	Type      DocumentType `json:"type"`
+	Language  string       `json:"language"`
+	ProductId uint         `json:"product"`
+}
+
+type ProductDocumentsTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	getDocumentByIdQuery         = `SELECT id, name, file, type, language, product_id FROM product_documents WHERE id = $1`
+	getDocumentsByProductIdQuery = `SELECT id, name, file, type, language, product_id FROM product_documents WHERE product_id = $1 ORDER BY type, language, id`
+	insertDocumentQuery          = `INSERT INTO product_documents (name, file, type, language, product_id) values ($1, $2, $3, $4, $5)
+									ON CONFLICT (product_id, type, language, name) DO UPDATE SET file = excluded.file RETURNING id`
+	deleteDocumentQuery = `DELETE FROM product_documents WHERE id = $1`
+)
+
+func NewProductDocumentsTable(db *pgxpool.Pool) *ProductDocumentsTable {
+	return &ProductDocumentsTable{db}
+}
+
+func (t *ProductDocumentsTable) GetById(id uint) (ProductDocument, error) {
+	var d ProductDocument
+	err := t.db.QueryRow(context.Background(), getDocumentByIdQuery, id).Scan(&d.Id, &d.Name, &d.File, &d.Type, &d.Language, &d.ProductId)
+	return d, err
+}
+
+func (t *ProductDocumentsTable) GetByProductId(productId uint) ([]ProductDocument, error) {
+	rows, err := t.db.Query(context.Background(), getDocumentsByProductIdQuery, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []ProductDocument
+	for rows.Next() {
+		var d ProductDocument
+
+		err = rows.Scan(&d.Id, &d.Name, &d.File, &d.Type, &d.Language, &d.ProductId)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, d)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+// Insert adds the document or, when the product already has a document of the
+// same type, language and name, replaces it and returns its id
+func (t *ProductDocumentsTable) Insert(d ProductDocument) (uint, error) {
+	var id uint
+	err := t.db.QueryRow(context.Background(), insertDocumentQuery, d.Name, d.File, d.Type, d.Language, d.ProductId).Scan(&id)
+	return id, err
+}
+
+func (t *ProductDocumentsTable) Delete(id uint) error {
+	_, err := t.db.Exec(context.Background(), deleteDocumentQuery, id)
+	return err
+}
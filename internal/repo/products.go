@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"strings"
+	"time"
 )
 
 type StockType int
@@ -20,7 +22,7 @@ type Product struct {
 	Id              uint        `json:"id"`
 	Name            string      `json:"name"`
 	Images          []string    `json:"images"`
-	Price           float32     `json:"price"`
+	Price           Money       `json:"price"`
 	Currency        uint        `json:"currency"`
 	Stock           StockType   `json:"stock"`
 	Discount        uint8       `json:"discount"`
@@ -28,6 +30,24 @@ type Product struct {
 	Characteristics [][2]string `json:"characteristics"`
 	SubjectId       uint        `json:"subject"`
 	BrandId         uint        `json:"brand"`
+	Colors          []string    `json:"colors"`
+
+	PriceFormatted         string `json:"priceFormatted,omitempty"`
+	DiscountPriceFormatted string `json:"discountPriceFormatted,omitempty"`
+
+	Converted *ConvertedPrice `json:"converted,omitempty"`
+}
+
+// ConvertedPrice is the product price in the requested currency at the rate of RateDate
+type ConvertedPrice struct {
+	Currency      uint       `json:"currency"`
+	Price         Money      `json:"price"`
+	DiscountPrice Money      `json:"discountPrice"`
+	Rate          Rate       `json:"rate"`
+	RateDate      *time.Time `json:"rateDate"`
+
+	PriceFormatted         string `json:"priceFormatted,omitempty"`
+	DiscountPriceFormatted string `json:"discountPriceFormatted,omitempty"`
 }
 
 type ProductsTable struct {
@@ -35,9 +55,24 @@ type ProductsTable struct {
 }
 
 const (
-	insertProductQuery = `INSERT INTO products (name, stock, price, currency, discount, images, description, characteristics, subject_id, brand_id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
-	updateProductQuery = `UPDATE products SET name = $2, stock = $3, price = $4, currency = $5, discount = $6, images = $7, description = $8, characteristics = $9, subject_id = $10, brand_id = $11 WHERE id = $1`
-	deleteProductQuery = `DELETE FROM products WHERE id = $1`
+	getProductByIdQuery     = `SELECT * FROM products WHERE id = $1`
+	getColoredProductsQuery = `SELECT * FROM products WHERE cardinality(colors) > 0`
+	insertProductQuery      = `INSERT INTO products (name, stock, price, currency, discount, images, description, characteristics, subject_id, brand_id, colors) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	updateProductQuery      = `UPDATE products SET name = $2, stock = $3, price = $4, currency = $5, discount = $6, images = $7, description = $8, characteristics = $9, subject_id = $10, brand_id = $11, colors = $12 WHERE id = $1`
+	deleteProductQuery      = `DELETE FROM products WHERE id = $1`
+
+	// brands merged into another one are still found by their old ids
+	brandConditionTemplate = `brand_id = COALESCE((SELECT brand_id FROM brand_aliases WHERE alias_id = $%[1]d::INTEGER), $%[1]d::INTEGER)`
+
+	// every facet of the requested tags must be covered by at least one of them
+	tagsConditionTemplate = `NOT EXISTS (
+		SELECT 1 FROM tags requested
+		WHERE requested.id = ANY($%[1]d::INTEGER[]) AND NOT EXISTS (
+			SELECT 1 FROM products_tags pt
+			JOIN tags t ON t.id = pt.tag_id
+			WHERE pt.product_id = products.id AND t.facet = requested.facet AND t.id = ANY($%[1]d::INTEGER[])
+		)
+	)`
 )
 
 func NewProductsTable(db *pgxpool.Pool) *ProductsTable {
@@ -50,11 +85,15 @@ type SearchProductsOptions struct {
 
 	Subject       string
 	SubjectFilter bool
+
+	// Tags are matched with OR inside one facet and with AND across facets
+	Tags       []uint
+	TagsFilter bool
 }
 
 func (t *ProductsTable) GetAllProducts(offset int, limit int, options SearchProductsOptions) ([]Product, error) {
-	query := t.prepareGetAllQuery(options)
-	rows, err := t.db.Query(context.Background(), query, offset, limit)
+	query, args := t.prepareGetAllQuery(options)
+	rows, err := t.db.Query(context.Background(), query, append([]any{offset, limit}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -63,18 +102,29 @@ func (t *ProductsTable) GetAllProducts(offset int, limit int, options SearchProd
 	for rows.Next() {
 		var p Product
 
-		var charBytes []byte
-		var currencyId *uint
-		err = rows.Scan(&p.Id, &p.Name, &p.Stock, &p.Price, &p.Discount, &p.Images, &p.Description, &charBytes, &p.SubjectId, &p.BrandId, &currencyId)
+		p, err = scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		if currencyId != nil {
-			p.Currency = *currencyId
-		}
+		res = append(res, p)
+	}
+	rows.Close()
 
-		err = json.Unmarshal(charBytes, &p.Characteristics)
+	return res, rows.Err()
+}
+
+func (t *ProductsTable) GetColored() ([]Product, error) {
+	rows, err := t.db.Query(context.Background(), getColoredProductsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Product
+	for rows.Next() {
+		var p Product
+
+		p, err = scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -86,15 +136,47 @@ func (t *ProductsTable) GetAllProducts(offset int, limit int, options SearchProd
 	return res, rows.Err()
 }
 
-func (t *ProductsTable) prepareGetAllQuery(options SearchProductsOptions) string {
+func (t *ProductsTable) GetById(id uint) (Product, error) {
+	return scanProduct(t.db.QueryRow(context.Background(), getProductByIdQuery, id))
+}
+
+func scanProduct(row pgx.Row) (Product, error) {
+	var p Product
+
+	var charBytes []byte
+	var currencyId *uint
+	err := row.Scan(&p.Id, &p.Name, &p.Stock, &p.Price, &p.Discount, &p.Images, &p.Description, &charBytes, &p.SubjectId, &p.BrandId, &currencyId, &p.Colors)
+	if err != nil {
+		return Product{}, err
+	}
+
+	if currencyId != nil {
+		p.Currency = *currencyId
+	}
+
+	err = json.Unmarshal(charBytes, &p.Characteristics)
+	if err != nil {
+		return Product{}, err
+	}
+
+	return p, nil
+}
+
+func (t *ProductsTable) prepareGetAllQuery(options SearchProductsOptions) (string, []any) {
 	var builder strings.Builder
 	builder.WriteString("SELECT * FROM products")
 	var conditions []string
+	var args []any
 	if options.SubjectFilter {
 		conditions = append(conditions, fmt.Sprintf("subject_id = %s", options.Subject))
 	}
 	if options.BrandFilter {
-		conditions = append(conditions, fmt.Sprintf("brand_id = %s", options.Brand))
+		args = append(args, options.Brand)
+		conditions = append(conditions, fmt.Sprintf(brandConditionTemplate, len(args)+2))
+	}
+	if options.TagsFilter {
+		args = append(args, options.Tags)
+		conditions = append(conditions, fmt.Sprintf(tagsConditionTemplate, len(args)+2))
 	}
 
 	conditionsStr := strings.Join(conditions, " AND ")
@@ -103,7 +185,7 @@ func (t *ProductsTable) prepareGetAllQuery(options SearchProductsOptions) string
 	}
 	builder.WriteString(" OFFSET $1 LIMIT $2")
 
-	return builder.String()
+	return builder.String(), args
 }
 
 func (t *ProductsTable) Insert(p Product, editFlag bool) error {
@@ -113,11 +195,11 @@ func (t *ProductsTable) Insert(p Product, editFlag bool) error {
 	}
 
 	if editFlag {
-		_, err = t.db.Exec(context.Background(), updateProductQuery, p.Id, p.Name, p.Stock, p.Price, p.Currency, p.Discount, p.Images, p.Description, charBytes, p.SubjectId, p.BrandId)
+		_, err = t.db.Exec(context.Background(), updateProductQuery, p.Id, p.Name, p.Stock, p.Price, p.Currency, p.Discount, p.Images, p.Description, charBytes, p.SubjectId, p.BrandId, p.Colors)
 		return err
 	}
 
-	_, err = t.db.Exec(context.Background(), insertProductQuery, p.Name, p.Stock, p.Price, p.Currency, p.Discount, p.Images, p.Description, charBytes, p.SubjectId, p.BrandId)
+	_, err = t.db.Exec(context.Background(), insertProductQuery, p.Name, p.Stock, p.Price, p.Currency, p.Discount, p.Images, p.Description, charBytes, p.SubjectId, p.BrandId, p.Colors)
 	return err
 }
 
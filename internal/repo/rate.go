@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5/pgtype"
+	"math/big"
+	"strings"
+)
+
+// rateScale is the number of decimal digits exchange rates are stored with
+const rateScale = 10
+
+var ErrInvalidRate = errors.New("invalid exchange rate")
+
+// Rate is an exact exchange rate. Inverse and cross rates are kept as exact
+// fractions, so amounts converted with them are rounded only once.
+// It is read and written as NUMERIC and marshalled to JSON as a decimal number.
+type Rate struct {
+	value *big.Rat
+}
+
+// NewRate returns the rate of the exact fraction num/denom
+func NewRate(num int64, denom int64) Rate {
+	return Rate{big.NewRat(num, denom)}
+}
+
+// RateOf returns the rate with the value of the passed fraction
+func RateOf(value *big.Rat) Rate {
+	return Rate{new(big.Rat).Set(value)}
+}
+
+// ParseRate parses a decimal number like "92.5012"
+func ParseRate(s string) (Rate, error) {
+	value, ok := parseDecimal(s)
+	if !ok {
+		return Rate{}, ErrInvalidRate
+	}
+
+	return Rate{value}, nil
+}
+
+func (r Rate) rat() *big.Rat {
+	if r.value == nil {
+		return new(big.Rat)
+	}
+
+	return r.value
+}
+
+func (r Rate) Sign() int {
+	return r.rat().Sign()
+}
+
+func (r Rate) IsZero() bool {
+	return r.Sign() == 0
+}
+
+// Inverse returns the rate of the opposite direction, zero for the zero rate
+func (r Rate) Inverse() Rate {
+	if r.IsZero() {
+		return Rate{}
+	}
+
+	return Rate{new(big.Rat).Inv(r.rat())}
+}
+
+// Mul chains the rate with the next one, e.g. USD->RUB with RUB->EUR
+func (r Rate) Mul(next Rate) Rate {
+	return Rate{new(big.Rat).Mul(r.rat(), next.rat())}
+}
+
+// Discount returns the rate that also reduces the amount by the percent
+func (r Rate) Discount(percent uint8) Rate {
+	return Rate{new(big.Rat).Mul(r.rat(), big.NewRat(int64(100-int(percent)), 100))}
+}
+
+func (r Rate) Equal(other Rate) bool {
+	return r.rat().Cmp(other.rat()) == 0
+}
+
+// String formats the rate rounded to the stored digits without trailing zeros
+func (r Rate) String() string {
+	s := r.rat().FloatString(rateScale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	}
+
+	return s
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accepts both numbers and decimal strings
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	value, err := ParseRate(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+
+	*r = value
+	return nil
+}
+
+func (r *Rate) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		*r = Rate{}
+		return nil
+	}
+
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return ErrInvalidRate
+	}
+
+	value := new(big.Rat).SetInt(v.Int)
+	factor := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(v.Exp))), nil))
+	if v.Exp >= 0 {
+		value.Mul(value, factor)
+	} else {
+		value.Quo(value, factor)
+	}
+
+	*r = Rate{value}
+	return nil
+}
+
+func (r Rate) NumericValue() (pgtype.Numeric, error) {
+	scaled := new(big.Rat).Mul(r.rat(), new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(rateScale), nil)))
+	return pgtype.Numeric{Int: roundRat(scaled), Exp: -rateScale, Valid: true}, nil
+}
+
+// parseDecimal parses an optionally signed decimal number without an exponent
+func parseDecimal(s string) (*big.Rat, bool) {
+	s = strings.TrimSpace(s)
+
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	integer, fraction, _ := strings.Cut(digits, ".")
+	if len(integer) == 0 && len(fraction) == 0 || strings.Trim(integer+fraction, "0123456789") != "" {
+		return nil, false
+	}
+
+	return new(big.Rat).SetString(s)
+}
+
+// roundRat rounds the fraction half away from zero to an integer
+func roundRat(value *big.Rat) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Mul(remainder.Abs(remainder), big.NewInt(2)).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+
+	return quotient
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
@@ -2,43 +2,89 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"paint-backend/internal/util/slug"
 )
 
 type Subject struct {
 	Id       uint   `json:"id"`
 	Name     string `json:"name"`
+	Slug     string `json:"slug"`
 	Image    string `json:"image"`
 	ParentId uint   `json:"parentId"`
+	Position int    `json:"position"`
 }
 
 type SubjectV2 struct {
 	Id       uint   `json:"id"`
 	Name     string `json:"name"`
+	Slug     string `json:"slug"`
 	Image    string `json:"image"`
 	ParentId uint   `json:"parentId"`
+	Position int    `json:"position"`
 	Children []uint `json:"children"`
 }
 
+type Breadcrumb struct {
+	Id    uint   `json:"id"`
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Image string `json:"image"`
+}
+
 type SubjectsTable struct {
 	db *pgxpool.Pool
+
+	// signs confirmation tokens of cascade deletions, shared by all instances
+	tokenSecret []byte
 }
 
 const (
-	getAllSubjectsQuery = `SELECT * FROM subjects`
-	insertSubjectQuery  = `INSERT INTO subjects (name, image, parent_id) values ($1, $2, $3)`
-	updateSubjectQuery  = `UPDATE subjects SET name = $2, image = $3, parent_id = $4 WHERE id = $1`
-	deleteSubjectQuery  = `DELETE FROM subjects WHERE id = $1`
+	getAllSubjectsQuery = `SELECT id, name, COALESCE(slug, ''), COALESCE(image, ''), parent_id, position FROM subjects ORDER BY parent_id NULLS FIRST, position, id`
+	insertSubjectQuery  = `INSERT INTO subjects (name, slug, image, parent_id, position) values ($1, $2, $3, $4, ` + nextPositionQuery + `)`
+	updateSubjectQuery  = `UPDATE subjects SET name = $2, slug = $3, image = $4 WHERE id = $1`
 
-	getAllSubjectsQueryV2 = `select s1.id, s1.name, s1.image, s1.parent_id, ARRAY_REMOVE(ARRAY_AGG(s2.id), NULL) children
+	getAllSubjectsQueryV2 = `select s1.id, s1.name, COALESCE(s1.slug, ''), COALESCE(s1.image, ''), s1.parent_id, s1.position, ARRAY_REMOVE(ARRAY_AGG(s2.id ORDER BY s2.position, s2.id), NULL) children
 							 from subjects s1
 							 left join subjects s2 on s1.id = s2.parent_id
-							 group by s1.id;`
+							 group by s1.id
+							 order by s1.parent_id NULLS FIRST, s1.position, s1.id;`
+
+	// position after the last child of the parent passed as $4
+	nextPositionQuery = `(SELECT COALESCE(MAX(position) + 1, 0) FROM subjects WHERE parent_id IS NOT DISTINCT FROM $4)`
+
+	slugExistsQuery         = `SELECT EXISTS(SELECT 1 FROM subjects WHERE slug = $1 AND id <> $2)`
+	getSubjectsWithoutSlugs = `SELECT id, name FROM subjects WHERE slug IS NULL OR slug = ''`
+	setSubjectSlugQuery     = `UPDATE subjects SET slug = $2 WHERE id = $1`
+
+	subjectsSlugIndex   = "subjects_slug_idx"
+	uniqueViolationCode = "23505"
+	slugAttempts        = 3
+
+	// depth limit protects from endless recursion if the tree is already broken
+	ancestorsCTE = `WITH RECURSIVE ancestors AS (
+						SELECT id, name, slug, image, parent_id, 0 AS level FROM subjects WHERE id = %s
+						UNION ALL
+						SELECT s.id, s.name, s.slug, s.image, s.parent_id, a.level + 1 FROM subjects s
+						JOIN ancestors a ON s.id = a.parent_id
+						WHERE a.level < 64
+					)
+					SELECT id, name, COALESCE(slug, ''), COALESCE(image, '') FROM ancestors ORDER BY level DESC`
+)
+
+var (
+	getSubjectAncestorsQuery = fmt.Sprintf(ancestorsCTE, "$1")
+	getProductAncestorsQuery = fmt.Sprintf(ancestorsCTE, "(SELECT subject_id FROM products WHERE id = $1)")
 )
 
-func NewSubjectsTable(db *pgxpool.Pool) *SubjectsTable {
-	return &SubjectsTable{db}
+// NewSubjectsTable creates the table signing confirmation tokens with the secret.
+// Without a secret the tokens still depend on the affected counts.
+func NewSubjectsTable(db *pgxpool.Pool, tokenSecret []byte) *SubjectsTable {
+	return &SubjectsTable{db, tokenSecret}
 }
 
 func (t *SubjectsTable) GetAll() ([]Subject, error) {
@@ -52,7 +98,7 @@ func (t *SubjectsTable) GetAll() ([]Subject, error) {
 		var b Subject
 
 		var parentId *uint
-		err = rows.Scan(&b.Id, &b.Name, &b.Image, &parentId)
+		err = rows.Scan(&b.Id, &b.Name, &b.Slug, &b.Image, &parentId, &b.Position)
 		if err != nil {
 			return nil, err
 		}
@@ -81,7 +127,7 @@ func (t *SubjectsTable) GetAllV2() ([]SubjectV2, error) {
 
 		var parentId *uint
 		var children pgtype.Array[uint]
-		err = rows.Scan(&b.Id, &b.Name, &b.Image, &parentId, &children)
+		err = rows.Scan(&b.Id, &b.Name, &b.Slug, &b.Image, &parentId, &b.Position, &children)
 		if err != nil {
 			return nil, err
 		}
@@ -100,17 +146,179 @@ func (t *SubjectsTable) GetAllV2() ([]SubjectV2, error) {
 	return res, rows.Err()
 }
 
-func (t *SubjectsTable) Insert(s Subject) error {
-	_, err := t.db.Exec(context.Background(), insertSubjectQuery, s.Name, s.Image, s.ParentId)
-	return err
+// Insert adds the subject as the last child of its parent. The parent must exist
+// and leave room for one more level within maxDepth.
+func (t *SubjectsTable) Insert(s Subject, maxDepth int) error {
+	return retrySlugConflict(func() error {
+		return t.insert(s, maxDepth)
+	})
+}
+
+func (t *SubjectsTable) insert(s Subject, maxDepth int) error {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), lockSubjectsQuery)
+	if err != nil {
+		return err
+	}
+
+	parentDepth, err := checkNewParent(tx, s.ParentId, nil)
+	if err != nil {
+		return err
+	}
+
+	if maxDepth > 0 && parentDepth+1 > maxDepth {
+		return ErrSubjectTooDeep
+	}
+
+	s.Slug, err = uniqueSlug(tx, s)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(context.Background(), insertSubjectQuery, s.Name, s.Slug, s.Image, nullableId(s.ParentId))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
 }
 
+// Update changes the name, slug and image of the subject. The parent is changed
+// only by Move, which checks the tree for cycles and depth.
 func (t *SubjectsTable) Update(s Subject) error {
-	_, err := t.db.Exec(context.Background(), updateSubjectQuery, s.Id, s.Name, s.Image, s.ParentId)
-	return err
+	return retrySlugConflict(func() error {
+		var err error
+		s.Slug, err = uniqueSlug(t.db, s)
+		if err != nil {
+			return err
+		}
+
+		_, err = t.db.Exec(context.Background(), updateSubjectQuery, s.Id, s.Name, s.Slug, s.Image)
+		return err
+	})
 }
 
-func (t *SubjectsTable) Delete(id uint) error {
-	_, err := t.db.Exec(context.Background(), deleteSubjectQuery, id)
+// uniqueSlug returns the slug of the subject, generating it from the name when
+// empty and adding a numeric suffix when it is already taken by another subject
+func uniqueSlug(q querier, s Subject) (string, error) {
+	base := slug.Make(s.Slug)
+	if len(base) == 0 {
+		base = slug.Make(s.Name)
+	}
+	if len(base) == 0 {
+		base = "subject"
+	}
+
+	candidate := base
+	for i := 2; ; i++ {
+		var exists bool
+		err := q.QueryRow(context.Background(), slugExistsQuery, candidate, s.Id).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// FillMissingSlugs generates slugs for subjects created before slugs were introduced
+func (t *SubjectsTable) FillMissingSlugs() error {
+	rows, err := t.db.Query(context.Background(), getSubjectsWithoutSlugs)
+	if err != nil {
+		return err
+	}
+
+	var subjects []Subject
+	for rows.Next() {
+		var s Subject
+
+		err = rows.Scan(&s.Id, &s.Name)
+		if err != nil {
+			return err
+		}
+
+		subjects = append(subjects, s)
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	for _, s := range subjects {
+		err = retrySlugConflict(func() error {
+			var err error
+			s.Slug, err = uniqueSlug(t.db, s)
+			if err != nil {
+				return err
+			}
+
+			_, err = t.db.Exec(context.Background(), setSubjectSlugQuery, s.Id, s.Slug)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retrySlugConflict repeats the write when a concurrent one took the same slug
+// between the uniqueSlug check and the write
+func retrySlugConflict(write func() error) error {
+	var err error
+	for i := 0; i < slugAttempts; i++ {
+		err = write()
+
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolationCode || pgErr.ConstraintName != subjectsSlugIndex {
+			return err
+		}
+	}
+
 	return err
 }
+
+// GetAncestors returns the chain of subjects from the root to the passed subject
+func (t *SubjectsTable) GetAncestors(subjectId uint) ([]Breadcrumb, error) {
+	return t.queryBreadcrumbs(getSubjectAncestorsQuery, subjectId)
+}
+
+// GetProductAncestors returns the chain of subjects from the root to the subject of the product
+func (t *SubjectsTable) GetProductAncestors(productId uint) ([]Breadcrumb, error) {
+	return t.queryBreadcrumbs(getProductAncestorsQuery, productId)
+}
+
+func (t *SubjectsTable) queryBreadcrumbs(query string, id uint) ([]Breadcrumb, error) {
+	rows, err := t.db.Query(context.Background(), query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Breadcrumb
+	for rows.Next() {
+		var b Breadcrumb
+
+		err = rows.Scan(&b.Id, &b.Name, &b.Slug, &b.Image)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, b)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
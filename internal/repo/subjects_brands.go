@@ -19,9 +19,23 @@ const (
 	getAllSubjectsBrandsQuery = `SELECT * FROM subjects_brands`
 	getBySubjectQuery         = `SELECT * FROM subjects_brands WHERE subject_id = $1`
 	getByBrandQuery           = `SELECT * FROM subjects_brands WHERE brand_id = $1`
-	insertSubjectBrandQuery   = `INSERT INTO subjects_brands (subject_id, brand_id) values ($1, $2)`
+	insertSubjectBrandQuery   = `INSERT INTO subjects_brands (subject_id, brand_id) values ($1, $2) ON CONFLICT (subject_id, brand_id) DO NOTHING`
+
+	lockSubjectsBrandsQuery   = `LOCK TABLE products, subjects_brands IN SHARE ROW EXCLUSIVE MODE`
+	deleteStaleSubjectsBrands = `DELETE FROM subjects_brands sb WHERE NOT EXISTS (
+									 SELECT 1 FROM products p WHERE p.subject_id = sb.subject_id AND p.brand_id = sb.brand_id
+								 )`
+	insertMissingSubjectsBrands = `INSERT INTO subjects_brands (subject_id, brand_id)
+								   SELECT DISTINCT subject_id, brand_id FROM products
+								   WHERE subject_id IS NOT NULL AND brand_id IS NOT NULL
+								   ON CONFLICT (subject_id, brand_id) DO NOTHING`
 )
 
+type SubjectBrandRebuildReport struct {
+	Removed int64 `json:"removed"`
+	Added   int64 `json:"added"`
+}
+
 func NewSubjectBrandTable(db *pgxpool.Pool) *SubjectBrandTable {
 	return &SubjectBrandTable{db}
 }
@@ -76,3 +90,35 @@ func (t *SubjectBrandTable) Insert(s SubjectBrand) error {
 	_, err := t.db.Exec(context.Background(), insertSubjectBrandQuery, s.SubjectId, s.BrandId)
 	return err
 }
+
+// Rebuild recomputes the subjects brands index from products. Normally the index is
+// kept up to date by the products trigger, so this is only needed to repair it.
+func (t *SubjectBrandTable) Rebuild() (SubjectBrandRebuildReport, error) {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return SubjectBrandRebuildReport{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), lockSubjectsBrandsQuery)
+	if err != nil {
+		return SubjectBrandRebuildReport{}, err
+	}
+
+	removed, err := tx.Exec(context.Background(), deleteStaleSubjectsBrands)
+	if err != nil {
+		return SubjectBrandRebuildReport{}, err
+	}
+
+	added, err := tx.Exec(context.Background(), insertMissingSubjectsBrands)
+	if err != nil {
+		return SubjectBrandRebuildReport{}, err
+	}
+
+	report := SubjectBrandRebuildReport{
+		Removed: removed.RowsAffected(),
+		Added:   added.RowsAffected(),
+	}
+
+	return report, tx.Commit(context.Background())
+}
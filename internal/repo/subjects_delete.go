@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+type SubjectDeleteMode string
+
+const (
+	// DeleteRestrict refuses to delete the subject if there are products in its subtree
+	DeleteRestrict SubjectDeleteMode = "restrict"
+	// DeleteReassign moves products and children of the subject to its parent or to the target subject
+	DeleteReassign SubjectDeleteMode = "reassign"
+	// DeleteCascade deletes the whole subtree with its products and requires a confirmation token
+	DeleteCascade SubjectDeleteMode = "cascade"
+)
+
+func (m SubjectDeleteMode) Valid() bool {
+	return m == DeleteRestrict || m == DeleteReassign || m == DeleteCascade
+}
+
+var (
+	ErrSubjectHasProducts  = errors.New("subject subtree has products")
+	ErrNoReassignTarget    = errors.New("top level subject requires a target subject to reassign to")
+	ErrInvalidConfirmation = errors.New("invalid or stale confirmation token")
+)
+
+type SubjectDeleteOptions struct {
+	Mode   SubjectDeleteMode
+	Target uint
+	Token  string
+}
+
+// SubjectDeletePreview lists what the delete affects. The pending price batches
+// targeting the deleted subjects are cancelled. Documents are the files of the
+// deleted products, the caller removes them from the storage after the delete.
+type SubjectDeletePreview struct {
+	Mode            SubjectDeleteMode `json:"mode"`
+	Target          uint              `json:"target,omitempty"`
+	DeletedSubjects int               `json:"deletedSubjects"`
+	DeletedProducts int               `json:"deletedProducts"`
+	MovedSubjects   int               `json:"movedSubjects"`
+	MovedProducts   int               `json:"movedProducts"`
+	BrandLinks      int               `json:"brandLinks"`
+	Documents       []string          `json:"documents"`
+	PriceBatches    []uint            `json:"priceBatches"`
+	Token           string            `json:"token,omitempty"`
+}
+
+const (
+	deleteSubjectQuery = `DELETE FROM subjects WHERE id = $1`
+
+	countChildrenQuery   = `SELECT count(*) FROM subjects WHERE parent_id = $1`
+	getSubjectsDocuments = `SELECT d.file FROM product_documents d
+							 JOIN products p ON p.id = d.product_id
+							 WHERE p.subject_id = ANY($1::INTEGER[])
+							 ORDER BY d.file`
+	reassignProductsQuery = `UPDATE products SET subject_id = $2 WHERE subject_id = $1`
+)
+
+// PreviewDelete reports what deleting the subject with the passed options would affect
+func (t *SubjectsTable) PreviewDelete(id uint, options SubjectDeleteOptions, maxDepth int) (SubjectDeletePreview, error) {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), lockSubjectsQuery)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	return t.prepareDelete(tx, id, options, maxDepth)
+}
+
+// Delete deletes the subject according to the mode and returns what was affected
+func (t *SubjectsTable) Delete(id uint, options SubjectDeleteOptions, maxDepth int) (SubjectDeletePreview, error) {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), lockSubjectsQuery)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	preview, err := t.prepareDelete(tx, id, options, maxDepth)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	switch options.Mode {
+	case DeleteRestrict:
+		if preview.DeletedProducts != 0 {
+			return SubjectDeletePreview{}, ErrSubjectHasProducts
+		}
+	case DeleteCascade:
+		if !hmac.Equal([]byte(options.Token), []byte(preview.Token)) {
+			return SubjectDeletePreview{}, ErrInvalidConfirmation
+		}
+	case DeleteReassign:
+		_, err = tx.Exec(context.Background(), moveSubjectChildrenQuery, id, preview.Target)
+		if err != nil {
+			return SubjectDeletePreview{}, err
+		}
+
+		_, err = tx.Exec(context.Background(), reassignProductsQuery, id, preview.Target)
+		if err != nil {
+			return SubjectDeletePreview{}, err
+		}
+	}
+
+	err = cancelBatches(tx, preview.PriceBatches)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	_, err = tx.Exec(context.Background(), deleteSubjectQuery, id)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	preview.Token = ""
+	return preview, tx.Commit(context.Background())
+}
+
+func (t *SubjectsTable) prepareDelete(q querier, id uint, options SubjectDeleteOptions, maxDepth int) (SubjectDeletePreview, error) {
+	preview := SubjectDeletePreview{Mode: options.Mode}
+
+	ids, height, err := getSubtree(q, id)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	if options.Mode != DeleteReassign {
+		var affected SubjectMoveReport
+		affected, err = countAffected(q, ids)
+		if err != nil {
+			return SubjectDeletePreview{}, err
+		}
+
+		preview.DeletedSubjects = affected.Subjects
+		preview.DeletedProducts = affected.Products
+		preview.BrandLinks = affected.BrandLinks
+
+		preview.PriceBatches, err = getPendingBatches(q, getSubjectsPendingBatchesQuery, ids)
+		if err != nil {
+			return SubjectDeletePreview{}, err
+		}
+
+		preview.Documents, err = getDocumentFiles(q, ids)
+		if err != nil {
+			return SubjectDeletePreview{}, err
+		}
+
+		if options.Mode == DeleteCascade {
+			preview.Token = t.confirmationToken(id, preview)
+		}
+
+		return preview, nil
+	}
+
+	preview.Target = options.Target
+	if preview.Target == 0 {
+		var parentId *uint
+		err = q.QueryRow(context.Background(), getSubjectParentQuery, id).Scan(&parentId)
+		if err != nil {
+			return SubjectDeletePreview{}, err
+		}
+
+		if parentId == nil {
+			return SubjectDeletePreview{}, ErrNoReassignTarget
+		}
+
+		preview.Target = *parentId
+	}
+
+	// the target must not be inside the subtree and must have room for the children subtrees
+	targetDepth, err := checkNewParent(q, preview.Target, ids)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	if maxDepth > 0 && targetDepth+height-1 > maxDepth {
+		return SubjectDeletePreview{}, ErrSubjectTooDeep
+	}
+
+	affected, err := countAffected(q, []uint{id})
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	err = q.QueryRow(context.Background(), countChildrenQuery, id).Scan(&preview.MovedSubjects)
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	preview.PriceBatches, err = getPendingBatches(q, getSubjectsPendingBatchesQuery, []uint{id})
+	if err != nil {
+		return SubjectDeletePreview{}, err
+	}
+
+	preview.Documents = []string{}
+	preview.DeletedSubjects = 1
+	preview.MovedProducts = affected.Products
+	preview.BrandLinks = affected.BrandLinks
+
+	return preview, nil
+}
+
+// confirmationToken signs the subject together with the affected counts,
+// so the token stops matching as soon as the subtree changes
+func (t *SubjectsTable) confirmationToken(id uint, preview SubjectDeletePreview) string {
+	mac := hmac.New(sha256.New, t.tokenSecret)
+	_, _ = fmt.Fprintf(mac, "%d:%d:%d:%d", id, preview.DeletedSubjects, preview.DeletedProducts, preview.BrandLinks)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func getDocumentFiles(q querier, subjectIds []uint) ([]string, error) {
+	rows, err := q.Query(context.Background(), getSubjectsDocuments, subjectIds)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for rows.Next() {
+		var file string
+
+		err = rows.Scan(&file)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	rows.Close()
+
+	return files, rows.Err()
+}
@@ -0,0 +1,280 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrSubjectCycle   = errors.New("subject can't be moved into its own subtree")
+	ErrSubjectTooDeep = errors.New("subjects tree becomes too deep")
+	ErrOrderMismatch  = errors.New("passed ids must be exactly the children of the parent")
+)
+
+type SubjectMoveReport struct {
+	Subjects   int `json:"subjects"`
+	Products   int `json:"products"`
+	BrandLinks int `json:"brandLinks"`
+}
+
+const (
+	lockSubjectsQuery = `LOCK TABLE subjects IN SHARE ROW EXCLUSIVE MODE`
+
+	getSubtreeQuery = `WITH RECURSIVE subtree AS (
+						   SELECT id, 1 AS level FROM subjects WHERE id = $1
+						   UNION ALL
+						   SELECT s.id, st.level + 1 FROM subjects s
+						   JOIN subtree st ON s.parent_id = st.id
+						   WHERE st.level < 64
+					   )
+					   SELECT id, level FROM subtree`
+	getAncestorIdsQuery = `WITH RECURSIVE ancestors AS (
+							   SELECT id, parent_id, 0 AS level FROM subjects WHERE id = $1
+							   UNION ALL
+							   SELECT s.id, s.parent_id, a.level + 1 FROM subjects s
+							   JOIN ancestors a ON s.id = a.parent_id
+							   WHERE a.level < 64
+						   )
+						   SELECT id FROM ancestors`
+
+	countSubjectsProductsQuery   = `SELECT count(*) FROM products WHERE subject_id = ANY($1::INTEGER[])`
+	countSubjectsBrandLinksQuery = `SELECT count(*) FROM subjects_brands WHERE subject_id = ANY($1::INTEGER[])`
+
+	getSubjectParentQuery    = `SELECT parent_id FROM subjects WHERE id = $1`
+	setSubjectParentQuery    = `UPDATE subjects SET parent_id = $2, position = (SELECT COALESCE(MAX(position) + 1, 0) FROM subjects WHERE parent_id IS NOT DISTINCT FROM $2) WHERE id = $1`
+	moveSubjectChildrenQuery = `UPDATE subjects SET parent_id = $2, position = position + (SELECT COALESCE(MAX(position) + 1, 0) FROM subjects WHERE parent_id IS NOT DISTINCT FROM $2) WHERE parent_id = $1`
+
+	getChildrenIdsQuery  = `SELECT id FROM subjects WHERE parent_id IS NOT DISTINCT FROM $1`
+	reorderChildrenQuery = `UPDATE subjects SET position = array_position($2::INTEGER[], id) - 1 WHERE parent_id IS NOT DISTINCT FROM $1`
+)
+
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Move re-parents the subject together with its subtree or, when subtree is false,
+// only the subject itself leaving its children to its current parent. Parent 0
+// makes the subject a top level one.
+func (t *SubjectsTable) Move(id uint, parentId uint, subtree bool, maxDepth int) (SubjectMoveReport, error) {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), lockSubjectsQuery)
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	var oldParentId *uint
+	err = tx.QueryRow(context.Background(), getSubjectParentQuery, id).Scan(&oldParentId)
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	ids, height, err := getSubtree(tx, id)
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	if !subtree {
+		ids, height = []uint{id}, 1
+
+		_, err = tx.Exec(context.Background(), moveSubjectChildrenQuery, id, oldParentId)
+		if err != nil {
+			return SubjectMoveReport{}, err
+		}
+	}
+
+	parentDepth, err := checkNewParent(tx, parentId, ids)
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	if maxDepth > 0 && parentDepth+height > maxDepth {
+		return SubjectMoveReport{}, ErrSubjectTooDeep
+	}
+
+	report, err := countAffected(tx, ids)
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	_, err = tx.Exec(context.Background(), setSubjectParentQuery, id, nullableId(parentId))
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	return report, tx.Commit(context.Background())
+}
+
+// Reorder sets the order of the parent children to the passed one. Parent 0 orders top level subjects.
+func (t *SubjectsTable) Reorder(parentId uint, ids []uint) error {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), lockSubjectsQuery)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(context.Background(), getChildrenIdsQuery, nullableId(parentId))
+	if err != nil {
+		return err
+	}
+
+	children := make(map[uint]bool)
+	for rows.Next() {
+		var childId uint
+
+		err = rows.Scan(&childId)
+		if err != nil {
+			return err
+		}
+
+		children[childId] = false
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	if len(children) != len(ids) {
+		return ErrOrderMismatch
+	}
+
+	for _, id := range ids {
+		seen, ok := children[id]
+		if !ok || seen {
+			return ErrOrderMismatch
+		}
+
+		children[id] = true
+	}
+
+	_, err = tx.Exec(context.Background(), reorderChildrenQuery, nullableId(parentId), ids)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// getSubtree returns ids of the subject and all its descendants and the number of levels in the subtree
+func getSubtree(q querier, id uint) ([]uint, int, error) {
+	rows, err := q.Query(context.Background(), getSubtreeQuery, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ids []uint
+	var height int
+	for rows.Next() {
+		var subjectId uint
+		var level int
+
+		err = rows.Scan(&subjectId, &level)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ids = append(ids, subjectId)
+		if level > height {
+			height = level
+		}
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil {
+		return nil, 0, rows.Err()
+	}
+
+	if len(ids) == 0 {
+		return nil, 0, pgx.ErrNoRows
+	}
+
+	return ids, height, nil
+}
+
+// checkNewParent makes sure the parent exists and is not one of the moved subjects,
+// returning the number of levels from the root down to the parent
+func checkNewParent(q querier, parentId uint, moved []uint) (int, error) {
+	if parentId == 0 {
+		return 0, nil
+	}
+
+	rows, err := q.Query(context.Background(), getAncestorIdsQuery, parentId)
+	if err != nil {
+		return 0, err
+	}
+
+	var depth int
+	var cycle bool
+	for rows.Next() {
+		var ancestorId uint
+
+		err = rows.Scan(&ancestorId)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, movedId := range moved {
+			if ancestorId == movedId {
+				cycle = true
+			}
+		}
+
+		depth++
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
+
+	if depth == 0 {
+		return 0, pgx.ErrNoRows
+	}
+
+	if cycle {
+		return 0, ErrSubjectCycle
+	}
+
+	return depth, nil
+}
+
+func countAffected(q querier, ids []uint) (SubjectMoveReport, error) {
+	report := SubjectMoveReport{Subjects: len(ids)}
+
+	err := q.QueryRow(context.Background(), countSubjectsProductsQuery, ids).Scan(&report.Products)
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	err = q.QueryRow(context.Background(), countSubjectsBrandLinksQuery, ids).Scan(&report.BrandLinks)
+	if err != nil {
+		return SubjectMoveReport{}, err
+	}
+
+	return report, nil
+}
+
+func nullableId(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+
+	return &id
+}
@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"sort"
+)
+
+type SubjectNode struct {
+	Id                uint           `json:"id"`
+	Name              string         `json:"name"`
+	Slug              string         `json:"slug"`
+	Image             string         `json:"image"`
+	Depth             int            `json:"depth"`
+	ProductCount      int            `json:"productCount"`
+	TotalProductCount int            `json:"totalProductCount"`
+	Brands            []uint         `json:"brands"`
+	Children          []*SubjectNode `json:"children"`
+}
+
+const (
+	getSubjectsProductCountsQuery = `SELECT subject_id, count(*) FROM products WHERE subject_id IS NOT NULL GROUP BY subject_id`
+	getSubjectsBrandsQuery        = `SELECT DISTINCT subject_id, brand_id FROM products WHERE subject_id IS NOT NULL AND brand_id IS NOT NULL`
+)
+
+// GetTree returns the nested subjects tree starting from the root subject or from
+// all top level subjects when root is 0. Counts and brands always include the
+// whole subtree, maxDepth only limits how many levels are returned (0 is unlimited)
+func (t *SubjectsTable) GetTree(root uint, maxDepth int) ([]*SubjectNode, error) {
+	subjects, err := t.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := t.getProductCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	brands, err := t.getBrands()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]Subject)
+	parents := make(map[uint]uint, len(subjects))
+	for _, s := range subjects {
+		children[s.ParentId] = append(children[s.ParentId], s)
+		parents[s.Id] = s.ParentId
+	}
+
+	if _, ok := parents[root]; root != 0 && !ok {
+		return nil, pgx.ErrNoRows
+	}
+
+	visited := make(map[uint]bool)
+	var build func(s Subject, depth int) (*SubjectNode, map[uint]struct{})
+	build = func(s Subject, depth int) (*SubjectNode, map[uint]struct{}) {
+		visited[s.Id] = true
+
+		node := &SubjectNode{
+			Id:           s.Id,
+			Name:         s.Name,
+			Slug:         s.Slug,
+			Image:        s.Image,
+			Depth:        depth,
+			ProductCount: counts[s.Id],
+			Children:     []*SubjectNode{},
+		}
+		node.TotalProductCount = node.ProductCount
+
+		brandSet := make(map[uint]struct{})
+		for _, b := range brands[s.Id] {
+			brandSet[b] = struct{}{}
+		}
+
+		for _, child := range children[s.Id] {
+			if visited[child.Id] {
+				continue
+			}
+
+			childNode, childBrands := build(child, depth+1)
+			node.TotalProductCount += childNode.TotalProductCount
+			for b := range childBrands {
+				brandSet[b] = struct{}{}
+			}
+
+			node.Children = append(node.Children, childNode)
+		}
+
+		node.Brands = make([]uint, 0, len(brandSet))
+		for b := range brandSet {
+			node.Brands = append(node.Brands, b)
+		}
+		sort.Slice(node.Brands, func(i, j int) bool {
+			return node.Brands[i] < node.Brands[j]
+		})
+
+		return node, brandSet
+	}
+
+	top := children[0]
+	var topDepth int
+	if root != 0 {
+		top = nil
+		for _, s := range subjects {
+			if s.Id == root {
+				top = append(top, s)
+			}
+		}
+
+		for id := parents[root]; id != 0 && topDepth < len(subjects); id = parents[id] {
+			topDepth++
+		}
+	}
+
+	res := make([]*SubjectNode, 0, len(top))
+	for _, s := range top {
+		node, _ := build(s, topDepth)
+		if maxDepth > 0 {
+			cutTree(node, maxDepth-1)
+		}
+
+		res = append(res, node)
+	}
+
+	return res, nil
+}
+
+func cutTree(node *SubjectNode, levels int) {
+	if levels == 0 {
+		node.Children = []*SubjectNode{}
+		return
+	}
+
+	for _, child := range node.Children {
+		cutTree(child, levels-1)
+	}
+}
+
+func (t *SubjectsTable) getProductCounts() (map[uint]int, error) {
+	rows, err := t.db.Query(context.Background(), getSubjectsProductCountsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[uint]int)
+	for rows.Next() {
+		var subjectId uint
+		var count int
+
+		err = rows.Scan(&subjectId, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		res[subjectId] = count
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+func (t *SubjectsTable) getBrands() (map[uint][]uint, error) {
+	rows, err := t.db.Query(context.Background(), getSubjectsBrandsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[uint][]uint)
+	for rows.Next() {
+		var subjectId, brandId uint
+
+		err = rows.Scan(&subjectId, &brandId)
+		if err != nil {
+			return nil, err
+		}
+
+		res[subjectId] = append(res[subjectId], brandId)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TagFacet string
+
+const (
+	ApplicationArea TagFacet = "application"
+	Surface         TagFacet = "surface"
+	Environment     TagFacet = "environment"
+)
+
+func (f TagFacet) Valid() bool {
+	return f == ApplicationArea || f == Surface || f == Environment
+}
+
+type Tag struct {
+	Id    uint     `json:"id"`
+	Name  string   `json:"name"`
+	Facet TagFacet `json:"facet"`
+}
+
+type TagsTable struct {
+	db *pgxpool.Pool
+}
+
+const (
+	getAllTagsQuery       = `SELECT id, name, facet FROM tags ORDER BY facet, name`
+	getTagsByProductQuery = `SELECT t.id, t.name, t.facet FROM tags t JOIN products_tags pt ON pt.tag_id = t.id WHERE pt.product_id = $1 ORDER BY t.facet, t.name`
+	insertTagQuery        = `INSERT INTO tags (name, facet) values ($1, $2)`
+	updateTagQuery        = `UPDATE tags SET name = $2, facet = $3 WHERE id = $1`
+	deleteTagQuery        = `DELETE FROM tags WHERE id = $1`
+
+	deleteProductTagsQuery = `DELETE FROM products_tags WHERE product_id = $1`
+	insertProductTagsQuery = `INSERT INTO products_tags (product_id, tag_id) SELECT $1, UNNEST($2::INTEGER[]) ON CONFLICT DO NOTHING`
+)
+
+func NewTagsTable(db *pgxpool.Pool) *TagsTable {
+	return &TagsTable{db}
+}
+
+func (t *TagsTable) GetAll() ([]Tag, error) {
+	return t.query(getAllTagsQuery)
+}
+
+func (t *TagsTable) GetByProductId(productId uint) ([]Tag, error) {
+	return t.query(getTagsByProductQuery, productId)
+}
+
+func (t *TagsTable) query(sql string, args ...any) ([]Tag, error) {
+	rows, err := t.db.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Tag
+	for rows.Next() {
+		var tag Tag
+
+		err = rows.Scan(&tag.Id, &tag.Name, &tag.Facet)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, tag)
+	}
+
+	rows.Close()
+
+	return res, rows.Err()
+}
+
+func (t *TagsTable) Insert(tag Tag, editFlag bool) error {
+	var err error
+
+	if editFlag {
+		_, err = t.db.Exec(context.Background(), updateTagQuery, tag.Id, tag.Name, tag.Facet)
+		return err
+	}
+
+	_, err = t.db.Exec(context.Background(), insertTagQuery, tag.Name, tag.Facet)
+	return err
+}
+
+func (t *TagsTable) Delete(id uint) error {
+	_, err := t.db.Exec(context.Background(), deleteTagQuery, id)
+	return err
+}
+
+// SetProductTags replaces all tags of the product with the passed ones
+func (t *TagsTable) SetProductTags(productId uint, tagIds []uint) error {
+	tx, err := t.db.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), deleteProductTagsQuery, productId)
+	if err != nil {
+		return err
+	}
+
+	if len(tagIds) != 0 {
+		_, err = tx.Exec(context.Background(), insertProductTagsQuery, productId, tagIds)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
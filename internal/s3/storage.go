@@ -1,17 +1,47 @@
 package s3
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/spf13/viper"
+	"net/http"
 	"os"
 	"paint-backend/pkg/fserver"
 	"paint-backend/pkg/s3storage"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
+const (
+	documentsFolder  = "documents"
+	temporaryFolder  = "visualizer"
+	renderFolder     = "_render"
+	originalsFolder  = "_originals"
+	quarantineFolder = "_quarantine"
+)
+
+// variantRegexp matches the width suffix of resized variants, e.g. "can@480w.jpg"
+var variantRegexp = regexp.MustCompile(`@(\d+)w(\.[^/.]*)?$`)
+
+type ImageVariant struct {
+	Width int    `json:"width"`
+	Name  string `json:"name"`
+}
+
+type ImageWithVariants struct {
+	Name     string         `json:"name"`
+	Variants []ImageVariant `json:"variants"`
+}
+
 type Storage struct {
-	fs        *fserver.CommonFileServer
-	imagesUrl string
+	fs           *fserver.CommonFileServer
+	imagesUrl    string
+	keepOriginal bool
 }
 
 func NewStorage() *Storage {
@@ -26,7 +56,8 @@ func NewStorage() *Storage {
 			Access:     os.Getenv(viper.GetString("s3.access")),
 			Secret:     os.Getenv(viper.GetString("s3.secret")),
 		})),
-		imagesUrl: fmt.Sprintf("%s/%s/", host, bucket),
+		imagesUrl:    fmt.Sprintf("%s/%s/", host, bucket),
+		keepOriginal: viper.GetBool("images.keepOriginal"),
 	}
 }
 
@@ -38,6 +69,10 @@ func (s *Storage) GetImages(path string) ([]string, error) {
 	}
 
 	for _, fileName := range list {
+		if IsServiceFile(fileName) {
+			continue
+		}
+
 		if strings.HasPrefix(fileName, path) && len(path) != len(fileName) {
 			images = append(images, fileName)
 		}
@@ -46,6 +81,37 @@ func (s *Storage) GetImages(path string) ([]string, error) {
 	return images, nil
 }
 
+// GetImagesWithVariants is GetImages with the resized variants of every image
+func (s *Storage) GetImagesWithVariants(path string) ([]ImageWithVariants, error) {
+	list, err := s.fs.GetFilesList()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []ImageWithVariants
+	variants := make(map[string][]ImageVariant)
+	for _, fileName := range list {
+		if original, width, ok := parseVariantName(fileName); ok {
+			variants[original] = append(variants[original], ImageVariant{Width: width, Name: fileName})
+			continue
+		}
+
+		if IsServiceFile(fileName) {
+			continue
+		}
+
+		if strings.HasPrefix(fileName, path) && len(path) != len(fileName) {
+			images = append(images, ImageWithVariants{Name: fileName})
+		}
+	}
+
+	for i := range images {
+		images[i].Variants = sortedVariants(variants[images[i].Name])
+	}
+
+	return images, nil
+}
+
 type Folder struct {
 	Name   string    `json:"name"`
 	Nested []*Folder `json:"nested"`
@@ -68,6 +134,10 @@ func (s *Storage) GetImagesFolders() ([]*Folder, error) {
 
 	foldersMap := map[string]*Folder{}
 	for _, row := range list {
+		if IsServiceFile(row) {
+			continue
+		}
+
 		split := strings.Split(row, "/")
 		if len(split) > 1 {
 			if len(split) == 2 {
@@ -123,15 +193,419 @@ func (s *Storage) GetImagesFolders() ([]*Folder, error) {
 	return folders, nil
 }
 
-func (s *Storage) InsertImage(name string, mime string, image []byte) error {
-	err := s.fs.PutImage(name, mime, image)
+// InsertImage stores the image, which must already be sanitized with imaging.Sanitize
+func (s *Storage) InsertImage(name string, format string, image []byte) error {
+	return s.fs.PutImage(name, "image/"+format, image)
+}
+
+// InsertOriginal keeps the raw upload when images.keepOriginal is set
+func (s *Storage) InsertOriginal(name string, mime string, image []byte) error {
+	if !s.keepOriginal {
+		return nil
+	}
+
+	return s.fs.PutImage(originalName(name), mime, image)
+}
+
+func originalName(name string) string {
+	return originalsFolder + "/" + name
+}
+
+func (s *Storage) GetImage(name string) ([]byte, error) {
+	return s.fs.GetFile(name)
+}
+
+func (s *Storage) ImageExists(name string) (bool, error) {
+	if IsServiceFile(name) {
+		return false, nil
+	}
+
+	return s.fs.FileExists(name)
+}
+
+// DeleteImage removes the image together with its original, resized variants and renditions
+func (s *Storage) DeleteImage(name string) error {
+	err := s.fs.RemoveFile(name)
+	if err != nil {
+		return err
+	}
+
+	variants, err := s.GetImageVariants(name)
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		err = s.fs.RemoveFile(variant.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the original may be kept from the time the flag was on
+	err = s.fs.RemoveFile(originalName(name))
+	if err != nil {
+		return err
+	}
+
+	return s.DeleteRenders(name)
+}
+
+func (s *Storage) InsertImageVariant(name string, width int, mime string, image []byte) (string, error) {
+	variant := VariantName(name, width)
+	err := s.fs.PutImage(variant, mime, image)
+	if err != nil {
+		return "", err
+	}
+
+	return variant, nil
+}
+
+// GetImageVariants returns the resized variants of the image from the narrowest one
+func (s *Storage) GetImageVariants(name string) ([]ImageVariant, error) {
+	list, err := s.fs.GetFilesList()
+	if err != nil {
+		return nil, err
+	}
+
+	return variantsOf(list, name), nil
+}
+
+func variantsOf(list []string, name string) []ImageVariant {
+	var variants []ImageVariant
+	for _, fileName := range list {
+		if original, width, ok := parseVariantName(fileName); ok && original == name {
+			variants = append(variants, ImageVariant{Width: width, Name: fileName})
+		}
+	}
+
+	return sortedVariants(variants)
+}
+
+// GetImagesWithMeta returns all images of the bucket with their modification time
+func (s *Storage) GetImagesWithMeta() ([]fserver.FileMeta, error) {
+	list, err := s.fs.GetFilesListWithMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []fserver.FileMeta
+	for _, file := range list {
+		if !IsServiceFile(file.Name) {
+			images = append(images, file)
+		}
+	}
+
+	return images, nil
+}
+
+// QuarantineImages moves the images with their variants to the quarantine folder,
+// where they stay until PurgeQuarantine removes them or RestoreImage brings them back.
+// The bucket is listed once for all the images, the images moved before a failure are returned.
+func (s *Storage) QuarantineImages(names []string) ([]string, error) {
+	list, err := s.fs.GetFilesList()
+	if err != nil {
+		return nil, err
+	}
+
+	quarantined := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, variant := range variantsOf(list, name) {
+			err = s.moveFile(variant.Name, quarantineName(variant.Name))
+			if err != nil {
+				return quarantined, err
+			}
+		}
+
+		err = s.moveFile(name, quarantineName(name))
+		if err != nil {
+			return quarantined, err
+		}
+
+		err = s.removeFiles(rendersOf(list, name))
+		if err != nil {
+			return quarantined, err
+		}
+
+		quarantined = append(quarantined, name)
+	}
+
+	return quarantined, nil
+}
+
+// RestoreImage moves the image with its variants back from the quarantine folder
+func (s *Storage) RestoreImage(name string) error {
+	list, err := s.fs.GetFilesList()
+	if err != nil {
+		return err
+	}
+
+	var found bool
+	for _, fileName := range list {
+		original := strings.TrimPrefix(fileName, quarantineFolder+"/")
+		if original == fileName {
+			continue
+		}
+
+		if variantOf, _, ok := parseVariantName(original); original != name && (!ok || variantOf != name) {
+			continue
+		}
+
+		err = s.moveFile(fileName, original)
+		if err != nil {
+			return err
+		}
+
+		found = found || original == name
+	}
+
+	if !found {
+		return fserver.ErrNotFound
+	}
+
+	return nil
+}
+
+// GetQuarantined returns the quarantined images, variants excluded, with the time they were quarantined
+func (s *Storage) GetQuarantined() ([]fserver.FileMeta, error) {
+	list, err := s.fs.GetFilesListWithMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []fserver.FileMeta
+	for _, file := range list {
+		name := strings.TrimPrefix(file.Name, quarantineFolder+"/")
+		if name == file.Name {
+			continue
+		}
+
+		if _, _, ok := parseVariantName(name); !ok {
+			images = append(images, fserver.FileMeta{Name: name, LastModified: file.LastModified})
+		}
+	}
+
+	return images, nil
+}
+
+// PurgeQuarantine removes the images that have been in quarantine longer than
+// the grace period, except the kept ones, and returns their names
+func (s *Storage) PurgeQuarantine(grace time.Duration, keep map[string]bool) ([]string, error) {
+	list, err := s.fs.GetFilesListWithMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	deadline := time.Now().Add(-grace)
+	for _, file := range list {
+		name := strings.TrimPrefix(file.Name, quarantineFolder+"/")
+		if name == file.Name || file.LastModified.After(deadline) {
+			continue
+		}
+
+		variantOf, _, isVariant := parseVariantName(name)
+		if keep[name] || (isVariant && keep[variantOf]) {
+			continue
+		}
+
+		err = s.fs.RemoveFile(file.Name)
+		if err != nil {
+			return purged, err
+		}
+
+		if !isVariant {
+			purged = append(purged, name)
+		}
+	}
+
+	return purged, nil
+}
+
+func quarantineName(name string) string {
+	return quarantineFolder + "/" + name
+}
+
+func (s *Storage) moveFile(from string, to string) error {
+	data, err := s.fs.GetFile(from)
+	if err != nil {
+		return err
+	}
+
+	err = s.fs.PutImage(to, http.DetectContentType(data), data)
+	if err != nil {
+		return err
+	}
+
+	return s.fs.RemoveFile(from)
+}
+
+// OpenImage returns the reader of the image together with its modification time
+func (s *Storage) OpenImage(name string) (fserver.FileReaderWithMeta, error) {
+	return s.fs.GetFileReaderWithMeta(name)
+}
+
+// RenderName derives the cache key of the rendition of the image. The key depends
+// on the modification time of the original, so replacing it invalidates the cache.
+func RenderName(name string, rendition string, modified time.Time, extension string) string {
+	return fmt.Sprintf("%s/%s/%s-%d.%s", renderFolder, name, rendition, modified.Unix(), extension)
+}
+
+// GetRender returns the cached rendition, false if it wasn't rendered yet
+func (s *Storage) GetRender(key string) ([]byte, bool, error) {
+	data, err := s.fs.GetFile(key)
+	if fserver.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+func (s *Storage) InsertRender(key string, mime string, image []byte) error {
+	return s.fs.PutImage(key, mime, image)
+}
+
+// DeleteRenders removes every cached rendition of the image
+func (s *Storage) DeleteRenders(name string) error {
+	list, err := s.fs.GetFilesList()
 	if err != nil {
 		return err
 	}
 
+	return s.removeFiles(rendersOf(list, name))
+}
+
+func rendersOf(list []string, name string) []string {
+	var renders []string
+	prefix := fmt.Sprintf("%s/%s/", renderFolder, name)
+	for _, fileName := range list {
+		if strings.HasPrefix(fileName, prefix) {
+			renders = append(renders, fileName)
+		}
+	}
+
+	return renders
+}
+
+func (s *Storage) removeFiles(names []string) error {
+	for _, name := range names {
+		err := s.fs.RemoveFile(name)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (s *Storage) DeleteImage(name string) error {
-	return s.fs.RemoveFile(name)
+// VariantName derives the key of the resized variant from the image name, e.g. "can.jpg" -> "can@480w.jpg"
+func VariantName(name string, width int) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s@%dw%s", strings.TrimSuffix(name, ext), width, ext)
+}
+
+func parseVariantName(name string) (string, int, bool) {
+	match := variantRegexp.FindStringSubmatchIndex(name)
+	if match == nil {
+		return "", 0, false
+	}
+
+	width, err := strconv.Atoi(name[match[2]:match[3]])
+	if err != nil {
+		return "", 0, false
+	}
+
+	var ext string
+	if match[4] >= 0 {
+		ext = name[match[4]:match[5]]
+	}
+
+	return name[:match[0]] + ext, width, true
+}
+
+func sortedVariants(variants []ImageVariant) []ImageVariant {
+	if variants == nil {
+		return []ImageVariant{}
+	}
+
+	sort.Slice(variants, func(i, j int) bool {
+		return variants[i].Width < variants[j].Width
+	})
+
+	return variants
+}
+
+func (s *Storage) InsertDocument(productId uint, name string, document []byte) (string, error) {
+	file := fmt.Sprintf("%s/%d/%s", documentsFolder, productId, name)
+	err := s.fs.PutFile(file, document)
+	if err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
+
+func (s *Storage) DeleteDocument(file string) error {
+	return s.fs.RemoveFile(file)
+}
+
+// InsertTemporaryImage stores the image under a random name that is removed
+// by CleanTemporaryImages once it becomes stale
+func (s *Storage) InsertTemporaryImage(extension string, mime string, image []byte) (string, error) {
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s/%s.%s", temporaryFolder, hex.EncodeToString(random), extension)
+	err = s.fs.PutImage(name, mime, image)
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func (s *Storage) CleanTemporaryImages(ttl time.Duration) (int, error) {
+	list, err := s.fs.GetFilesListWithMeta()
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	deadline := time.Now().Add(-ttl)
+	for _, file := range list {
+		if !strings.HasPrefix(file.Name, temporaryFolder+"/") || file.LastModified.After(deadline) {
+			continue
+		}
+
+		err = s.fs.RemoveFile(file.Name)
+		if err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// IsServiceFile reports whether the object is stored in the bucket for
+// something other than images and must be hidden from the images API
+func IsServiceFile(name string) bool {
+	if _, _, ok := parseVariantName(name); ok {
+		return true
+	}
+
+	for _, folder := range []string{documentsFolder, temporaryFolder, renderFolder, originalsFolder, quarantineFolder} {
+		if strings.HasPrefix(name, folder+"/") {
+			return true
+		}
+	}
+
+	return false
 }
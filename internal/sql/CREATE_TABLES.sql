@@ -2,28 +2,66 @@ CREATE TABLE IF NOT EXISTS subjects
 (
     id   SERIAL PRIMARY KEY,
     name VARCHAR NOT NULL,
+    slug VARCHAR,
     image VARCHAR,
+    position INTEGER NOT NULL DEFAULT 0,
 
     parent_id INTEGER REFERENCES subjects (id) ON DELETE CASCADE ON UPDATE CASCADE
 );
 
+CREATE UNIQUE INDEX IF NOT EXISTS subjects_slug_idx ON subjects (slug);
+
 CREATE TABLE IF NOT EXISTS brands
 (
     id SERIAL PRIMARY KEY,
-    name VARCHAR NOT NULL
+    name VARCHAR NOT NULL,
+    logo VARCHAR,
+    country VARCHAR,
+    description VARCHAR,
+    website VARCHAR,
+    featured BOOLEAN NOT NULL DEFAULT FALSE
 );
 
 CREATE TABLE IF NOT EXISTS currency
 (
     id SERIAL PRIMARY KEY,
-    name VARCHAR NOT NULL
-)
+    name VARCHAR NOT NULL,
+    code CHAR(3) UNIQUE,
+    symbol VARCHAR,
+    minor_units SMALLINT NOT NULL DEFAULT 2,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS currency_default_idx ON currency (is_default) WHERE is_default;
+
+INSERT INTO currency (name, code, symbol, minor_units, is_default) VALUES
+    ('Российский рубль', 'RUB', '₽', 2, TRUE),
+    ('Доллар США', 'USD', '$', 2, FALSE),
+    ('Евро', 'EUR', '€', 2, FALSE),
+    ('Китайский юань', 'CNY', '¥', 2, FALSE),
+    ('Казахстанский тенге', 'KZT', '₸', 2, FALSE),
+    ('Белорусский рубль', 'BYN', 'Br', 2, FALSE)
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS exchange_rates
+(
+    id SERIAL PRIMARY KEY,
+    from_currency INTEGER NOT NULL REFERENCES currency (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    to_currency INTEGER NOT NULL REFERENCES currency (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    effective_date DATE NOT NULL,
+
+    UNIQUE (from_currency, to_currency, effective_date),
+    CHECK (from_currency <> to_currency)
+);
 
 CREATE TABLE IF NOT EXISTS subjects_brands
 (
     id SERIAL PRIMARY KEY,
     subject_id INTEGER REFERENCES subjects (id) ON DELETE CASCADE ON UPDATE CASCADE,
-    brand_id INTEGER REFERENCES brands (id) ON DELETE CASCADE ON UPDATE CASCADE
+    brand_id INTEGER REFERENCES brands (id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    UNIQUE (subject_id, brand_id)
 );
 
 CREATE TABLE IF NOT EXISTS products
@@ -31,8 +69,8 @@ CREATE TABLE IF NOT EXISTS products
     id SERIAL PRIMARY KEY,
     name VARCHAR NOT NULL,
     stock SMALLINT NOT NULL,
-    price REAL NOT NULL,
-    discount SMALLINT NOT NULL,
+    price NUMERIC(14, 4) NOT NULL CHECK (price >= 0),
+    discount SMALLINT NOT NULL CHECK (discount BETWEEN 0 AND 100),
     images VARCHAR[],
     description VARCHAR,
     characteristics bytea,
@@ -40,5 +78,174 @@ CREATE TABLE IF NOT EXISTS products
     subject_id INTEGER REFERENCES subjects (id) ON DELETE CASCADE ON UPDATE CASCADE,
     brand_id INTEGER REFERENCES brands (id) ON DELETE CASCADE ON UPDATE CASCADE,
 
-    currency INTEGER REFERENCES currency (id)
-);
\ No newline at end of file
+    currency INTEGER REFERENCES currency (id),
+
+    colors VARCHAR[]
+);
+
+CREATE TABLE IF NOT EXISTS product_documents
+(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    file VARCHAR NOT NULL,
+    type VARCHAR NOT NULL,
+    language VARCHAR NOT NULL,
+
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    UNIQUE (product_id, type, language, name)
+);
+
+CREATE TABLE IF NOT EXISTS tags
+(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    facet VARCHAR NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS products_tags
+(
+    product_id INTEGER REFERENCES products (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    tag_id INTEGER REFERENCES tags (id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    PRIMARY KEY (product_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS color_collections
+(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    description VARCHAR,
+    cover_image VARCHAR,
+    publish_from TIMESTAMPTZ,
+    publish_to TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS collection_colors
+(
+    id SERIAL PRIMARY KEY,
+    position INTEGER NOT NULL,
+    name VARCHAR NOT NULL,
+    hex VARCHAR(7) NOT NULL,
+
+    collection_id INTEGER NOT NULL REFERENCES color_collections (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    product_id INTEGER REFERENCES products (id) ON DELETE SET NULL ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS image_palettes
+(
+    name VARCHAR PRIMARY KEY,
+    colors VARCHAR[] NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS brand_aliases
+(
+    alias_id INTEGER PRIMARY KEY,
+    brand_id INTEGER NOT NULL REFERENCES brands (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- keeps subjects_brands equal to the distinct (subject, brand) pairs of products;
+-- the advisory lock serializes concurrent changes of the same pair
+CREATE OR REPLACE FUNCTION sync_subjects_brands() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.subject_id IS NOT NULL AND OLD.brand_id IS NOT NULL THEN
+        PERFORM pg_advisory_xact_lock(OLD.subject_id, OLD.brand_id);
+
+        DELETE FROM subjects_brands sb
+        WHERE sb.subject_id = OLD.subject_id AND sb.brand_id = OLD.brand_id AND NOT EXISTS (
+            SELECT 1 FROM products p WHERE p.subject_id = OLD.subject_id AND p.brand_id = OLD.brand_id
+        );
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.subject_id IS NOT NULL AND NEW.brand_id IS NOT NULL THEN
+        PERFORM pg_advisory_xact_lock(NEW.subject_id, NEW.brand_id);
+
+        INSERT INTO subjects_brands (subject_id, brand_id) VALUES (NEW.subject_id, NEW.brand_id)
+        ON CONFLICT (subject_id, brand_id) DO NOTHING;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER products_subjects_brands
+    AFTER INSERT OR DELETE OR UPDATE OF subject_id, brand_id
+    ON products
+    FOR EACH ROW
+EXECUTE FUNCTION sync_subjects_brands();
+
+CREATE TABLE IF NOT EXISTS price_history
+(
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    price NUMERIC(14, 4) NOT NULL,
+    discount SMALLINT NOT NULL,
+    currency INTEGER REFERENCES currency (id) ON DELETE SET NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS price_history_product_idx ON price_history (product_id, changed_at);
+CREATE INDEX IF NOT EXISTS price_history_changed_at_idx ON price_history (changed_at);
+
+-- remembers every price, discount or currency a product ever had
+CREATE OR REPLACE FUNCTION track_price_history() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' OR (NEW.price, NEW.discount, NEW.currency) IS DISTINCT FROM (OLD.price, OLD.discount, OLD.currency) THEN
+        INSERT INTO price_history (product_id, price, discount, currency) VALUES (NEW.id, NEW.price, NEW.discount, NEW.currency);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER products_price_history
+    AFTER INSERT OR UPDATE OF price, discount, currency
+    ON products
+    FOR EACH ROW
+EXECUTE FUNCTION track_price_history();
+
+-- products created before the history was tracked start it with their current price
+INSERT INTO price_history (product_id, price, discount, currency)
+SELECT p.id, p.price, p.discount, p.currency FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM price_history h WHERE h.product_id = p.id);
+
+CREATE TABLE IF NOT EXISTS price_batches
+(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    effective_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+
+    rule_percent NUMERIC(7, 4),
+    rule_brand_id INTEGER REFERENCES brands (id) ON DELETE SET NULL ON UPDATE CASCADE,
+    rule_subject_id INTEGER REFERENCES subjects (id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    applied_at TIMESTAMPTZ,
+    changed_products INTEGER NOT NULL DEFAULT 0,
+
+    CHECK (rule_percent IS NULL OR rule_percent > -100)
+);
+
+CREATE INDEX IF NOT EXISTS price_batches_pending_idx ON price_batches (effective_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS price_batch_items
+(
+    batch_id INTEGER NOT NULL REFERENCES price_batches (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    price NUMERIC(14, 4) NOT NULL CHECK (price >= 0),
+
+    PRIMARY KEY (batch_id, product_id)
+);
+
+CREATE TABLE IF NOT EXISTS image_hashes
+(
+    name VARCHAR PRIMARY KEY,
+    hash CHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS image_hashes_hash_idx ON image_hashes (hash);
@@ -0,0 +1,7 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS colors VARCHAR[];
+
+CREATE TABLE IF NOT EXISTS image_palettes
+(
+    name VARCHAR PRIMARY KEY,
+    colors VARCHAR[] NOT NULL
+);
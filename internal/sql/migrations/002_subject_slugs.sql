@@ -0,0 +1,3 @@
+ALTER TABLE subjects ADD COLUMN IF NOT EXISTS slug VARCHAR;
+
+-- slugs of existing subjects are generated by the backend on startup
@@ -0,0 +1,6 @@
+ALTER TABLE subjects ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+
+UPDATE subjects s
+SET position = ordered.position
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY id) - 1 AS position FROM subjects) ordered
+WHERE s.id = ordered.id;
@@ -0,0 +1,5 @@
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS logo VARCHAR;
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS country VARCHAR;
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS description VARCHAR;
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS website VARCHAR;
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS featured BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS brand_aliases
+(
+    alias_id INTEGER PRIMARY KEY,
+    brand_id INTEGER NOT NULL REFERENCES brands (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
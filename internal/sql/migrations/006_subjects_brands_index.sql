@@ -0,0 +1,46 @@
+DELETE FROM subjects_brands WHERE subject_id IS NULL OR brand_id IS NULL;
+
+DELETE FROM subjects_brands a
+USING subjects_brands b
+WHERE a.id > b.id AND a.subject_id = b.subject_id AND a.brand_id = b.brand_id;
+
+ALTER TABLE subjects_brands ADD CONSTRAINT subjects_brands_subject_id_brand_id_key UNIQUE (subject_id, brand_id);
+
+CREATE OR REPLACE FUNCTION sync_subjects_brands() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.subject_id IS NOT NULL AND OLD.brand_id IS NOT NULL THEN
+        PERFORM pg_advisory_xact_lock(OLD.subject_id, OLD.brand_id);
+
+        DELETE FROM subjects_brands sb
+        WHERE sb.subject_id = OLD.subject_id AND sb.brand_id = OLD.brand_id AND NOT EXISTS (
+            SELECT 1 FROM products p WHERE p.subject_id = OLD.subject_id AND p.brand_id = OLD.brand_id
+        );
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.subject_id IS NOT NULL AND NEW.brand_id IS NOT NULL THEN
+        PERFORM pg_advisory_xact_lock(NEW.subject_id, NEW.brand_id);
+
+        INSERT INTO subjects_brands (subject_id, brand_id) VALUES (NEW.subject_id, NEW.brand_id)
+        ON CONFLICT (subject_id, brand_id) DO NOTHING;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER products_subjects_brands
+    AFTER INSERT OR DELETE OR UPDATE OF subject_id, brand_id
+    ON products
+    FOR EACH ROW
+EXECUTE FUNCTION sync_subjects_brands();
+
+-- bring the index in line with the current products
+DELETE FROM subjects_brands sb WHERE NOT EXISTS (
+    SELECT 1 FROM products p WHERE p.subject_id = sb.subject_id AND p.brand_id = sb.brand_id
+);
+
+INSERT INTO subjects_brands (subject_id, brand_id)
+SELECT DISTINCT subject_id, brand_id FROM products
+WHERE subject_id IS NOT NULL AND brand_id IS NOT NULL
+ON CONFLICT (subject_id, brand_id) DO NOTHING;
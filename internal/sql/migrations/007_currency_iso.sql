@@ -0,0 +1,27 @@
+ALTER TABLE currency ADD COLUMN IF NOT EXISTS code CHAR(3) UNIQUE;
+ALTER TABLE currency ADD COLUMN IF NOT EXISTS symbol VARCHAR;
+ALTER TABLE currency ADD COLUMN IF NOT EXISTS minor_units SMALLINT NOT NULL DEFAULT 2;
+ALTER TABLE currency ADD COLUMN IF NOT EXISTS is_default BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS currency_default_idx ON currency (is_default) WHERE is_default;
+
+-- existing rows named after their code keep their ids and get the code assigned
+UPDATE currency c SET code = upper(trim(c.name))
+WHERE c.code IS NULL AND upper(trim(c.name)) IN ('RUB', 'USD', 'EUR', 'CNY', 'KZT', 'BYN')
+  AND NOT EXISTS (SELECT 1 FROM currency o WHERE o.code = upper(trim(c.name)));
+
+INSERT INTO currency (name, code, symbol, minor_units) VALUES
+    ('Российский рубль', 'RUB', '₽', 2),
+    ('Доллар США', 'USD', '$', 2),
+    ('Евро', 'EUR', '€', 2),
+    ('Китайский юань', 'CNY', '¥', 2),
+    ('Казахстанский тенге', 'KZT', '₸', 2),
+    ('Белорусский рубль', 'BYN', 'Br', 2)
+ON CONFLICT DO NOTHING;
+
+UPDATE currency SET symbol = s.symbol
+FROM (VALUES ('RUB', '₽'), ('USD', '$'), ('EUR', '€'), ('CNY', '¥'), ('KZT', '₸'), ('BYN', 'Br')) AS s (code, symbol)
+WHERE currency.code = s.code AND currency.symbol IS NULL;
+
+UPDATE currency SET is_default = TRUE
+WHERE code = 'RUB' AND NOT EXISTS (SELECT 1 FROM currency WHERE is_default);
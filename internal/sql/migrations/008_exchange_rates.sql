@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS exchange_rates
+(
+    id SERIAL PRIMARY KEY,
+    from_currency INTEGER NOT NULL REFERENCES currency (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    to_currency INTEGER NOT NULL REFERENCES currency (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    effective_date DATE NOT NULL,
+
+    UNIQUE (from_currency, to_currency, effective_date),
+    CHECK (from_currency <> to_currency)
+);
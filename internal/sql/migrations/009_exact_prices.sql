@@ -0,0 +1,12 @@
+-- going through DOUBLE PRECISION keeps every digit REAL has, a direct cast keeps only six
+ALTER TABLE products ALTER COLUMN price TYPE NUMERIC(14, 4) USING round(price::DOUBLE PRECISION::NUMERIC, 4);
+
+-- drop the float noise by rounding to the precision of the product currency
+UPDATE products p SET price = round(p.price, c.minor_units)
+FROM currency c
+WHERE c.id = p.currency AND p.price <> round(p.price, c.minor_units);
+
+UPDATE products SET price = round(price, 2)
+WHERE currency IS NULL AND price <> round(price, 2);
+
+ALTER TABLE products ADD CONSTRAINT products_price_check CHECK (price >= 0);
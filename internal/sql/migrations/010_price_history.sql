@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS price_history
+(
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    price NUMERIC(14, 4) NOT NULL,
+    discount SMALLINT NOT NULL,
+    currency INTEGER REFERENCES currency (id) ON DELETE SET NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS price_history_product_idx ON price_history (product_id, changed_at);
+CREATE INDEX IF NOT EXISTS price_history_changed_at_idx ON price_history (changed_at);
+
+CREATE OR REPLACE FUNCTION track_price_history() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' OR (NEW.price, NEW.discount, NEW.currency) IS DISTINCT FROM (OLD.price, OLD.discount, OLD.currency) THEN
+        INSERT INTO price_history (product_id, price, discount, currency) VALUES (NEW.id, NEW.price, NEW.discount, NEW.currency);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER products_price_history
+    AFTER INSERT OR UPDATE OF price, discount, currency
+    ON products
+    FOR EACH ROW
+EXECUTE FUNCTION track_price_history();
+
+-- the current prices are the starting point of the history
+INSERT INTO price_history (product_id, price, discount, currency)
+SELECT p.id, p.price, p.discount, p.currency FROM products p
+WHERE NOT EXISTS (SELECT 1 FROM price_history h WHERE h.product_id = p.id);
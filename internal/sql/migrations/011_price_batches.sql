@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS price_batches
+(
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    effective_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+
+    rule_percent NUMERIC(7, 4),
+    rule_brand_id INTEGER REFERENCES brands (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    rule_subject_id INTEGER REFERENCES subjects (id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    applied_at TIMESTAMPTZ,
+    changed_products INTEGER NOT NULL DEFAULT 0,
+
+    CHECK (rule_percent IS NULL OR rule_percent > -100)
+);
+
+CREATE INDEX IF NOT EXISTS price_batches_pending_idx ON price_batches (effective_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS price_batch_items
+(
+    batch_id INTEGER NOT NULL REFERENCES price_batches (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    price NUMERIC(14, 4) NOT NULL CHECK (price >= 0),
+
+    PRIMARY KEY (batch_id, product_id)
+);
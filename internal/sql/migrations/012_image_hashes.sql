@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS image_hashes
+(
+    name VARCHAR PRIMARY KEY,
+    hash CHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS image_hashes_hash_idx ON image_hashes (hash);
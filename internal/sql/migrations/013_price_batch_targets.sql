@@ -0,0 +1,9 @@
+-- deleting a brand or a subject must not silently drop the batches targeting it,
+-- pending ones are repointed or cancelled by the application before the delete
+ALTER TABLE price_batches
+    DROP CONSTRAINT IF EXISTS price_batches_rule_brand_id_fkey,
+    ADD CONSTRAINT price_batches_rule_brand_id_fkey FOREIGN KEY (rule_brand_id) REFERENCES brands (id) ON DELETE SET NULL ON UPDATE CASCADE;
+
+ALTER TABLE price_batches
+    DROP CONSTRAINT IF EXISTS price_batches_rule_subject_id_fkey,
+    ADD CONSTRAINT price_batches_rule_subject_id_fkey FOREIGN KEY (rule_subject_id) REFERENCES subjects (id) ON DELETE SET NULL ON UPDATE CASCADE;
@@ -0,0 +1,5 @@
+-- a discount over 100 percent makes the price negative
+UPDATE products SET discount = 100 WHERE discount > 100;
+UPDATE products SET discount = 0 WHERE discount < 0;
+
+ALTER TABLE products ADD CONSTRAINT products_discount_check CHECK (discount BETWEEN 0 AND 100);
@@ -0,0 +1,6 @@
+-- the file key is derived from these columns, so duplicate rows share one file
+DELETE FROM product_documents a
+USING product_documents b
+WHERE a.id > b.id AND a.product_id = b.product_id AND a.type = b.type AND a.language = b.language AND a.name = b.name;
+
+ALTER TABLE product_documents ADD CONSTRAINT product_documents_product_id_type_language_name_key UNIQUE (product_id, type, language, name);
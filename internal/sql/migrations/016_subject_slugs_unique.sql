@@ -0,0 +1,5 @@
+-- duplicated and empty slugs are cleared, the backend generates them again on startup
+UPDATE subjects s SET slug = NULL
+WHERE s.slug = '' OR EXISTS(SELECT 1 FROM subjects o WHERE o.slug = s.slug AND o.id < s.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS subjects_slug_idx ON subjects (slug);
@@ -0,0 +1,50 @@
+package slug
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// Make converts the name into a lowercase latin slug, cyrillic letters are transliterated
+// and diacritics are stripped from latin ones
+func Make(name string) string {
+	var builder strings.Builder
+	dash := false
+	// composed first, so "й" stays a letter of its own instead of "и" with a breve
+	for _, r := range norm.NFC.String(strings.ToLower(name)) {
+		if latin, ok := cyrillic[r]; ok {
+			builder.WriteString(latin)
+			dash = false
+			continue
+		}
+
+		// the decomposition of a latin letter with diacritics starts with the plain letter, e.g. "é" -> "e"
+		if r >= unicode.MaxASCII {
+			if base := []rune(norm.NFD.String(string(r)))[0]; base < unicode.MaxASCII {
+				r = base
+			}
+		}
+
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			builder.WriteRune(r)
+			dash = false
+			continue
+		}
+
+		if !dash && builder.Len() != 0 {
+			builder.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(builder.String(), "-")
+}
@@ -0,0 +1,29 @@
+package slug
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Interior paints", want: "interior-paints"},
+		{name: "Краски для стен", want: "kraski-dlya-sten"},
+		{name: "Эмаль ПФ-115", want: "emal-pf-115"},
+		{name: "Щётки и валики", want: "schetki-i-valiki"},
+		{name: "  --Lacquer & Varnish--  ", want: "lacquer-varnish"},
+		{name: "Объём 2,5 л", want: "obem-2-5-l"},
+		{name: "Café", want: "cafe"},
+		{name: "Crème brûlée", want: "creme-brulee"},
+		{name: "Мой край", want: "moy-kray"},
+		{name: "Мои\u0306 краи\u0306", want: "moy-kray"},
+		{name: "!!!", want: ""},
+		{name: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Make(tt.name); got != tt.want {
+			t.Errorf("Make(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
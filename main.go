@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -10,8 +12,10 @@ import (
 	"os/signal"
 	"paint-backend/internal/endpoint"
 	"paint-backend/internal/logger"
+	"paint-backend/internal/reconcile"
 	"paint-backend/internal/repo"
 	"paint-backend/internal/s3"
+	"time"
 )
 
 var (
@@ -24,6 +28,15 @@ var (
 	subjectsTable     *repo.SubjectsTable
 	brandsTable       *repo.BrandsTable
 	subjectBrandTable *repo.SubjectBrandTable
+	documentsTable    *repo.ProductDocumentsTable
+	tagsTable         *repo.TagsTable
+	collectionsTable  *repo.CollectionsTable
+	palettesTable     *repo.ImagePalettesTable
+	ratesTable        *repo.ExchangeRatesTable
+	priceHistoryTable *repo.PriceHistoryTable
+	priceBatchesTable *repo.PriceBatchesTable
+	imageHashesTable  *repo.ImageHashesTable
+	referencesTable   *repo.ImageReferencesTable
 )
 
 func main() {
@@ -33,7 +46,15 @@ func main() {
 	setupTables()
 	setupStorage()
 
-	httpHandler = endpoint.NewHttpHandler(storage, productsTable, currencyTable, subjectsTable, brandsTable, subjectBrandTable)
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcile(os.Args[2:])
+		return
+	}
+
+	go cleanTemporaryImages()
+	go applyPriceBatches()
+
+	httpHandler = endpoint.NewHttpHandler(storage, productsTable, currencyTable, subjectsTable, brandsTable, subjectBrandTable, documentsTable, tagsTable, collectionsTable, palettesTable, ratesTable, priceHistoryTable, priceBatchesTable, imageHashesTable, referencesTable)
 	go func() {
 		logrus.Info("Server was started")
 		err := fasthttp.ListenAndServe("0.0.0.0:8000", httpHandler.Handle)
@@ -77,11 +98,90 @@ func setupDatabase() {
 func setupTables() {
 	productsTable = repo.NewProductsTable(dbPool)
 	currencyTable = repo.NewCurrencyTable(dbPool)
-	subjectsTable = repo.NewSubjectsTable(dbPool)
+	subjectsTable = repo.NewSubjectsTable(dbPool, []byte(os.Getenv(viper.GetString("subjects.confirmationSecret"))))
+	err := subjectsTable.FillMissingSlugs()
+	if err != nil {
+		logrus.Error("Failed to fill missing subject slugs: ", err.Error())
+	}
+
 	brandsTable = repo.NewBrandsTable(dbPool)
 	subjectBrandTable = repo.NewSubjectBrandTable(dbPool)
+	documentsTable = repo.NewProductDocumentsTable(dbPool)
+	tagsTable = repo.NewTagsTable(dbPool)
+	collectionsTable = repo.NewCollectionsTable(dbPool)
+	palettesTable = repo.NewImagePalettesTable(dbPool)
+	ratesTable = repo.NewExchangeRatesTable(dbPool)
+	priceHistoryTable = repo.NewPriceHistoryTable(dbPool)
+	priceBatchesTable = repo.NewPriceBatchesTable(dbPool)
+	imageHashesTable = repo.NewImageHashesTable(dbPool)
+	referencesTable = repo.NewImageReferencesTable(dbPool)
 }
 
 func setupStorage() {
 	storage = s3.NewStorage()
 }
+
+func cleanTemporaryImages() {
+	ttl := viper.GetDuration("visualizer.ttl")
+	if ttl <= 0 {
+		logrus.Warn("visualizer.ttl is not set, temporary images won't be cleaned")
+		return
+	}
+
+	ticker := time.NewTicker(ttl / 2)
+	for range ticker.C {
+		removed, err := storage.CleanTemporaryImages(ttl)
+		if err != nil {
+			logrus.Error("failed to clean temporary images: ", err.Error())
+		}
+
+		if removed != 0 {
+			logrus.Infof("Removed %d temporary images", removed)
+		}
+	}
+}
+
+func applyPriceBatches() {
+	interval := viper.GetDuration("prices.batchInterval")
+	if interval <= 0 {
+		logrus.Warn("prices.batchInterval is not set, price batches won't be applied")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		applied, err := priceBatchesTable.ApplyDue()
+		if err != nil {
+			logrus.Error("failed to apply price batches: ", err.Error())
+		}
+
+		for _, b := range applied {
+			logrus.Infof("Applied price batch %d, changed %d products", b.Id, b.ChangedProducts)
+		}
+	}
+}
+
+// runReconcile prints the image reconciliation report to stdout, e.g.
+// "paint-backend reconcile -quarantine -purge"
+func runReconcile(args []string) {
+	options := reconcile.LoadOptions()
+
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	flags.BoolVar(&options.Quarantine, "quarantine", false, "move orphaned images to the quarantine")
+	flags.BoolVar(&options.Purge, "purge", false, "delete images quarantined longer than the grace period")
+	flags.DurationVar(&options.MinAge, "min-age", options.MinAge, "ignore images uploaded more recently")
+	flags.DurationVar(&options.Grace, "grace", options.Grace, "time images stay in the quarantine")
+	_ = flags.Parse(args)
+
+	reconciler := reconcile.NewReconciler(storage, referencesTable, palettesTable, imageHashesTable)
+	report, err := reconciler.Run(options)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+
+	dbPool.Close()
+	if err != nil {
+		logrus.Fatal("failed to reconcile images: ", err.Error())
+	}
+}
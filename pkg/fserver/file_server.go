@@ -1,7 +1,10 @@
 package fserver
 
 import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"io"
+	"net/http"
 	"paint-backend/pkg/s3storage"
 	"time"
 )
@@ -23,6 +26,7 @@ type FileReaderWithMeta struct {
 
 type FileServer interface {
 	RemoveFile(file string) error
+	FileExists(file string) (bool, error)
 	GetFilesList() ([]string, error)
 	GetFilesListWithMeta() ([]FileMeta, error)
 	PutFile(file string, data []byte) error
@@ -96,3 +100,28 @@ func (fs *S3FileServerBase) RemoveFile(file string) error {
 	_, err := fs.s3.DeleteObject(file)
 	return err
 }
+
+func (fs *S3FileServerBase) FileExists(file string) (bool, error) {
+	_, err := fs.s3.HeadObject(file)
+	if err == nil {
+		return true, nil
+	}
+
+	if IsNotFound(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+var ErrNotFound = errors.New("file not found")
+
+// IsNotFound reports whether the error is caused by a missing object
+func IsNotFound(err error) bool {
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
+
+	var requestErr awserr.RequestFailure
+	return errors.As(err, &requestErr) && requestErr.StatusCode() == http.StatusNotFound
+}
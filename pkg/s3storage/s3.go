@@ -16,6 +16,7 @@ type S3Storage interface {
 	UploadObject(string, []byte) (*s3.PutObjectOutput, error)
 	UploadImage(string, string, []byte) (*s3.PutObjectOutput, error)
 	GetObject(string) (*s3.GetObjectOutput, error)
+	HeadObject(string) (*s3.HeadObjectOutput, error)
 	DeleteObject(string) (*s3.DeleteObjectOutput, error)
 }
 
@@ -76,11 +77,12 @@ func (p *ImplS3Storage) connect() {
 
 func (p *ImplS3Storage) UploadObject(filename string, data []byte) (*s3.PutObjectOutput, error) {
 	return p.session.PutObject(&s3.PutObjectInput{
-		Body:        aws.ReadSeekCloser(bytes.NewReader(data)),
-		Bucket:      aws.String(p.bucketName),
-		Key:         aws.String(filename),
-		ACL:         aws.String(s3.BucketCannedACLPublicRead),
-		ContentType: aws.String("jpeg"),
+		Body:          aws.ReadSeekCloser(bytes.NewReader(data)),
+		Bucket:        aws.String(p.bucketName),
+		Key:           aws.String(filename),
+		ACL:           aws.String(s3.BucketCannedACLPublicRead),
+		ContentType:   aws.String(http.DetectContentType(data)),
+		ContentLength: aws.Int64(int64(len(data))),
 	})
 }
 
@@ -109,6 +111,13 @@ func (p *ImplS3Storage) GetObject(filename string) (*s3.GetObjectOutput, error)
 	})
 }
 
+func (p *ImplS3Storage) HeadObject(filename string) (*s3.HeadObjectOutput, error) {
+	return p.session.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(p.bucketName),
+		Key:    aws.String(filename),
+	})
+}
+
 func (p *ImplS3Storage) DeleteObject(filename string) (*s3.DeleteObjectOutput, error) {
 	return p.session.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(p.bucketName),